@@ -1,15 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/cr0hn/dockerfile-sec/internal/analyzer"
+	"github.com/cr0hn/dockerfile-sec/internal/entropy"
+	"github.com/cr0hn/dockerfile-sec/internal/eol"
+	"github.com/cr0hn/dockerfile-sec/internal/fix"
 	"github.com/cr0hn/dockerfile-sec/internal/ignore"
 	"github.com/cr0hn/dockerfile-sec/internal/output"
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/placeholder"
+	"github.com/cr0hn/dockerfile-sec/internal/policy"
 	"github.com/cr0hn/dockerfile-sec/internal/rules"
 )
 
@@ -23,6 +32,10 @@ func (s *stringSliceFlag) Set(v string) error {
 }
 
 func main() {
+	run := run
+	if len(os.Args) > 1 && os.Args[1] == "pin" {
+		run = func() error { return runPin(os.Args[2:]) }
+	}
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "[!]  %v\n", err)
 		os.Exit(1)
@@ -37,7 +50,23 @@ func run() error {
 		internalRules string
 		outputFile    string
 		quiet         bool
+		verbose       bool
+		noRedact      bool
+		reveal        int
 		codeExit      bool
+		firstMatch    bool
+		target        string
+		buildArgs     stringSliceFlag
+		buildArgFiles stringSliceFlag
+		strict        bool
+		ruleTimeout   time.Duration
+		scanTimeout   time.Duration
+		policyFile    string
+		eolFile       string
+		allowlistFile string
+		thresholds    = entropy.DefaultThresholds
+		fixInPlace    bool
+		fixDiff       bool
 	)
 
 	flag.Var(&ignoreFiles, "F", "ignore file (repeatable)")
@@ -46,43 +75,48 @@ func run() error {
 	flag.StringVar(&internalRules, "R", "all", "built-in rules: core, credentials, security, packages, configuration, all, none (comma-separated)")
 	flag.StringVar(&outputFile, "o", "", "output file path (JSON)")
 	flag.BoolVar(&quiet, "q", false, "quiet mode")
+	flag.BoolVar(&verbose, "verbose", false, "show the remediation and an example fix of each rule reported in the table")
+	flag.BoolVar(&noRedact, "no-redact", false, "print secrets found in full instead of masking them (for local use only)")
+	flag.IntVar(&reveal, "redact-reveal", 0, "number of characters of masked secrets to show at each end")
 	flag.BoolVar(&codeExit, "E", false, "exit code 1 if issues found")
+	flag.BoolVar(&firstMatch, "first-match", false, "report only the first occurrence of each rule")
+	flag.StringVar(&target, "target", "", "build stage (name or index) that produces the image, default: last stage")
+	flag.Var(&buildArgs, "build-arg", "build-time variable KEY=VALUE, as in docker build (repeatable)")
+	flag.Var(&buildArgFiles, "build-arg-file", "file with one KEY=VALUE build-time variable per line (repeatable)")
+	flag.BoolVar(&strict, "strict", false, "fail if any rule is invalid instead of skipping it")
+	flag.DurationVar(&ruleTimeout, "rule-timeout", rules.DefaultTimeout, "time a rule without its own timeout may spend on the Dockerfile")
+	flag.DurationVar(&scanTimeout, "scan-timeout", 0, "time the whole scan may take, 0 for no limit")
+	flag.StringVar(&eolFile, "eol-catalog", "", "end-of-life catalog file replacing the built-in one")
+	flag.StringVar(&policyFile, "policy", "", "image policy file with allowed registries and allowed/denied images")
+	flag.StringVar(&allowlistFile, "placeholders", "", "placeholder allowlist file extending the built-in one, for values secret rules skip")
+	flag.Float64Var(&thresholds.Hex, "entropy-hex", thresholds.Hex, "entropy in bits per character from which hex strings are reported by ent-001, 0 to disable")
+	flag.Float64Var(&thresholds.Base64, "entropy-base64", thresholds.Base64, "entropy in bits per character from which base64 strings are reported by ent-002, 0 to disable")
+	flag.BoolVar(&fixInPlace, "fix", false, "apply the fixes of fixable issues to the Dockerfile, then report what is left")
+	flag.BoolVar(&fixDiff, "fix-diff", false, "print the fixes of fixable issues as a unified diff instead of the report")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: dockerfile-sec [OPTIONS] [DOCKERFILE]\n\nAnalyze a Dockerfile for security issues.\n\nOptions:\n")
+		fmt.Fprintf(os.Stderr, "Usage: dockerfile-sec [OPTIONS] [DOCKERFILE]\n       dockerfile-sec pin [OPTIONS] [DOCKERFILE]\n\nAnalyze a Dockerfile for security issues, or pin its images to digests.\n\nOptions:\n")
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
 	// Load Dockerfile content
-	var content string
 	args := flag.Args()
 
-	if len(args) > 0 {
-		data, err := os.ReadFile(args[0])
-		if err != nil {
-			return fmt.Errorf("reading Dockerfile: %w", err)
-		}
-		content = string(data)
-	} else {
-		// Try reading from stdin
-		info, err := os.Stdin.Stat()
-		if err != nil {
-			return fmt.Errorf("checking stdin: %w", err)
-		}
-		if info.Mode()&os.ModeCharDevice != 0 {
-			return fmt.Errorf("Dockerfile is needed")
-		}
-		data, err := io.ReadAll(os.Stdin)
-		if err != nil {
-			return fmt.Errorf("reading stdin: %w", err)
-		}
-		content = string(data)
+	if reveal < 0 {
+		return fmt.Errorf("-redact-reveal must not be negative")
+	}
+	if thresholds.Hex < 0 || thresholds.Base64 < 0 {
+		return fmt.Errorf("entropy thresholds must not be negative")
+	}
+	if fixInPlace && len(args) == 0 {
+		return fmt.Errorf("-fix needs a Dockerfile path; use -fix-diff to review the fixes of stdin")
 	}
 
-	if content == "" {
-		return fmt.Errorf("Dockerfile is needed")
+	content, err := readDockerfile(args)
+	if err != nil {
+		return err
 	}
 
 	// Load rules
@@ -90,13 +124,79 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	checks, err := analyzer.LoadChecks(internalRules)
+	if err != nil {
+		return err
+	}
+	if policyFile != "" {
+		p, err := policy.Load(policyFile)
+		if err != nil {
+			return err
+		}
+		checks = append(checks, analyzer.PolicyChecks(p)...)
+	}
+	var eolCatalog *eol.Catalog
+	if eolFile != "" {
+		if eolCatalog, err = eol.Load(eolFile); err != nil {
+			return err
+		}
+	}
+
+	var placeholders *placeholder.Allowlist
+	if allowlistFile != "" {
+		extra, err := placeholder.Load(allowlistFile)
+		if err != nil {
+			return err
+		}
+		placeholders = placeholder.Default().Extend(extra)
+	}
 
+	var (
+		problems rules.ValidationErrors
+		external []rules.Rule
+	)
 	for _, rf := range rulesFiles {
 		ext, err := rules.LoadExternal(rf)
-		if err != nil {
+		var invalid rules.ValidationErrors
+		if errors.As(err, &invalid) {
+			problems = append(problems, invalid...)
+		} else if err != nil {
 			return err
 		}
-		allRules = append(allRules, ext...)
+		external = append(external, ext...)
+	}
+
+	// External rules must not reuse the ID of any built-in rule or check,
+	// selected or not, or of another external rule.
+	taken, err := builtinRules(checks)
+	if err != nil {
+		return err
+	}
+	external, err = rules.UniqueIDs(taken, external)
+	var duplicates rules.ValidationErrors
+	if errors.As(err, &duplicates) {
+		problems = append(problems, duplicates...)
+	}
+	allRules = append(allRules, external...)
+
+	// Invalid rules are reported and skipped, the rest still run, unless -strict
+	if len(problems) > 0 {
+		if strict {
+			return fmt.Errorf("invalid rules:\n%w", problems)
+		}
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", p)
+		}
+	}
+
+	ruleSet, err := rules.Compile(allRules, ruleTimeout)
+	if err != nil {
+		if strict {
+			return fmt.Errorf("invalid rules:\n%w", err)
+		}
+		for _, msg := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", msg)
+		}
 	}
 
 	// Load ignores
@@ -105,18 +205,200 @@ func run() error {
 		return err
 	}
 
-	// Analyze
-	issues := analyzer.Analyze(content, allRules, ignored)
+	buildArgValues, err := loadBuildArgs(buildArgs, buildArgFiles)
+	if err != nil {
+		return err
+	}
+
+	// Analyze. Suppression comments are only warned about once, not on each
+	// fix pass.
+	warned := false
+	analyze := func(content string) ([]rules.Issue, error) {
+		df, err := parser.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("parsing Dockerfile: %w", err)
+		}
+		suppressions, warnings := ignore.ParseInline(df)
+		if !warned {
+			for _, w := range warnings {
+				fmt.Fprintf(os.Stderr, "warning: skipping suppression comment: %v\n", w)
+			}
+			warned = true
+		}
+		issues, err := analyzer.Analyze(df, ruleSet, ignored, analyzer.Options{
+			FirstMatchOnly: firstMatch,
+			Target:         target,
+			BuildArgs:      buildArgValues,
+			ScanTimeout:    scanTimeout,
+			Checks:         checks,
+			EOLCatalog:     eolCatalog,
+			Entropy:        &thresholds,
+			Placeholders:   placeholders,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return suppressions.Apply(issues), nil
+	}
+
+	issues, err := analyze(content)
+	if err != nil {
+		return err
+	}
+
+	// Fixes are applied in passes, as fixes touching the same text wait for
+	// the issues of the fixed content.
+	if fixInPlace || fixDiff {
+		fixed, remaining, n := content, issues, 0
+		for pass := 0; pass < maxFixPasses; pass++ {
+			next, count := fix.Apply(fixed, remaining)
+			if count == 0 {
+				break
+			}
+			if remaining, err = analyze(next); err != nil {
+				return err
+			}
+			fixed, n = next, n+count
+		}
+
+		if fixDiff {
+			name := "Dockerfile"
+			if len(args) > 0 {
+				name = args[0]
+			}
+			diff := fix.Diff(name, content, fixed)
+			if !noRedact {
+				diff = output.RedactText(diff, issues, reveal)
+			}
+			fmt.Print(diff)
+			quiet = true
+		} else if n > 0 {
+			info, err := os.Stat(args[0])
+			if err != nil {
+				return fmt.Errorf("writing fixed Dockerfile: %w", err)
+			}
+			if err := os.WriteFile(args[0], []byte(fixed), info.Mode().Perm()); err != nil {
+				return fmt.Errorf("writing fixed Dockerfile: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "fixed %d issue(s) in %s\n", n, args[0])
+			issues = remaining
+		}
+	}
 
 	// Output
-	if err := output.Render(issues, quiet, outputFile); err != nil {
+	if err := output.Render(issues, output.Options{
+		Quiet:      quiet,
+		Verbose:    verbose,
+		OutputFile: outputFile,
+		NoRedact:   noRedact,
+		Reveal:     reveal,
+	}); err != nil {
 		return err
 	}
 
 	// Exit code
-	if codeExit && len(issues) > 0 {
+	if codeExit && len(rules.Unsuppressed(issues)) > 0 {
 		os.Exit(1)
 	}
 
 	return nil
 }
+
+// builtinRules returns the rules of every built-in category and of every
+// built-in and extra check.
+func builtinRules(extra []analyzer.Check) ([]rules.Rule, error) {
+	taken, err := rules.LoadInternal("all")
+	if err != nil {
+		return nil, err
+	}
+	checks, err := analyzer.LoadChecks("all")
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range append(checks, extra...) {
+		taken = append(taken, c.Rule())
+	}
+	return taken, nil
+}
+
+// readDockerfile reads the Dockerfile named by the first of args, or stdin
+// when there is none.
+func readDockerfile(args []string) (string, error) {
+	var content string
+	if len(args) > 0 {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return "", fmt.Errorf("reading Dockerfile: %w", err)
+		}
+		content = string(data)
+	} else {
+		// Try reading from stdin
+		info, err := os.Stdin.Stat()
+		if err != nil {
+			return "", fmt.Errorf("checking stdin: %w", err)
+		}
+		if info.Mode()&os.ModeCharDevice != 0 {
+			return "", fmt.Errorf("Dockerfile is needed")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading stdin: %w", err)
+		}
+		content = string(data)
+	}
+
+	if content == "" {
+		return "", fmt.Errorf("Dockerfile is needed")
+	}
+	return content, nil
+}
+
+// maxFixPasses bounds the fix passes of -fix and -fix-diff.
+const maxFixPasses = 5
+
+// loadBuildArgs merges build-arg files and --build-arg flags (flags win) into a
+// map. As with docker build, a bare KEY takes its value from the environment
+// and is skipped when the variable is not set.
+func loadBuildArgs(flags []string, files []string) (map[string]string, error) {
+	args := make(map[string]string)
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading build-arg file %s: %w", path, err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			setBuildArg(args, line)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading build-arg file %s: %w", path, err)
+		}
+	}
+
+	for _, arg := range flags {
+		setBuildArg(args, arg)
+	}
+
+	return args, nil
+}
+
+func setBuildArg(args map[string]string, arg string) {
+	key, value, ok := strings.Cut(arg, "=")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return
+	}
+	if !ok {
+		if value, ok = os.LookupEnv(key); !ok {
+			return
+		}
+	}
+	args[key] = value
+}
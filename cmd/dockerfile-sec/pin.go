@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cr0hn/dockerfile-sec/internal/fix"
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/pin"
+	"github.com/cr0hn/dockerfile-sec/internal/registry"
+)
+
+// runPin implements "dockerfile-sec pin": it pins the FROM images of a
+// Dockerfile to the digests of their tags, or verifies existing pins.
+func runPin(arguments []string) error {
+	var (
+		endpoints     stringSliceFlag
+		verify        bool
+		diff          bool
+		authHost      string
+		username      string
+		passwordStdin bool
+		timeout       time.Duration
+	)
+
+	flags := flag.NewFlagSet("pin", flag.ExitOnError)
+	flags.BoolVar(&verify, "verify", false, "check that pinned digests still match their tags instead of pinning")
+	flags.BoolVar(&diff, "diff", false, "print the pins as a unified diff instead of rewriting the Dockerfile")
+	flags.Var(&endpoints, "registry", "registry API endpoint as HOST=URL, e.g. docker.io=http://localhost:5000 (repeatable)")
+	flags.StringVar(&authHost, "registry-auth", os.Getenv("DOCKERFILE_SEC_REGISTRY_HOST"), "registry host, e.g. registry.example.com, that the credentials are sent to; no other registry gets them")
+	flags.StringVar(&username, "username", os.Getenv("DOCKERFILE_SEC_REGISTRY_USERNAME"), "registry username")
+	flags.BoolVar(&passwordStdin, "password-stdin", false, "read the registry password from stdin")
+	flags.DurationVar(&timeout, "timeout", 30*time.Second, "time to resolve all images")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dockerfile-sec pin [OPTIONS] [DOCKERFILE]\n\nPin FROM images to the digests of their tags.\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(arguments)
+	args := flags.Args()
+
+	client := &registry.Client{Endpoints: make(map[string]string)}
+	password := os.Getenv("DOCKERFILE_SEC_REGISTRY_PASSWORD")
+	for _, ep := range endpoints {
+		host, url, ok := strings.Cut(ep, "=")
+		if !ok || host == "" || url == "" {
+			return fmt.Errorf("invalid -registry %q: want HOST=URL", ep)
+		}
+		client.Endpoints[host] = url
+	}
+	if passwordStdin {
+		if len(args) == 0 {
+			return fmt.Errorf("-password-stdin needs a Dockerfile path")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading password from stdin: %w", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+	if username != "" {
+		if authHost == "" {
+			return fmt.Errorf("registry credentials need -registry-auth HOST, the registry they are for")
+		}
+		client.Credentials = map[string]registry.Credentials{authHost: {Username: username, Password: password}}
+	}
+
+	content, err := readDockerfile(args)
+	if err != nil {
+		return err
+	}
+	df, err := parser.Parse(content)
+	if err != nil {
+		return fmt.Errorf("parsing Dockerfile: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	results, edits := pin.Pin(ctx, df, client, verify)
+
+	var failed, stale int
+	for _, res := range results {
+		switch res.Status {
+		case pin.Pinned:
+			fmt.Fprintf(os.Stderr, "line %d: pinned %s to %s\n", res.Line, res.Ref.Raw, res.Digest)
+		case pin.Verified:
+			fmt.Fprintf(os.Stderr, "line %d: %s is up to date\n", res.Line, res.Ref.Raw)
+		case pin.Stale:
+			stale++
+			fmt.Fprintf(os.Stderr, "line %d: %s is stale, tag now points to %s\n", res.Line, res.Ref.Raw, res.Digest)
+		case pin.Skipped:
+			fmt.Fprintf(os.Stderr, "line %d: skipped %s (%s)\n", res.Line, res.Ref.Raw, res.Reason)
+		case pin.Failed:
+			failed++
+			fmt.Fprintf(os.Stderr, "line %d: cannot resolve %s: %v\n", res.Line, res.Ref.Raw, res.Err)
+		}
+	}
+
+	if !verify {
+		pinned, _ := fix.ApplyEdits(content, edits)
+		switch {
+		case diff:
+			name := "Dockerfile"
+			if len(args) > 0 {
+				name = args[0]
+			}
+			fmt.Print(fix.Diff(name, content, pinned))
+		case len(args) == 0:
+			fmt.Print(pinned)
+		case pinned != content:
+			info, err := os.Stat(args[0])
+			if err != nil {
+				return fmt.Errorf("writing pinned Dockerfile: %w", err)
+			}
+			if err := os.WriteFile(args[0], []byte(pinned), info.Mode().Perm()); err != nil {
+				return fmt.Errorf("writing pinned Dockerfile: %w", err)
+			}
+		}
+	}
+
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d image(s) could not be resolved", failed)
+	case stale > 0:
+		return fmt.Errorf("%d pinned digest(s) no longer match their tags", stale)
+	}
+	return nil
+}
@@ -1,42 +1,425 @@
 package analyzer
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"runtime"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/cr0hn/dockerfile-sec/internal/entropy"
+	"github.com/cr0hn/dockerfile-sec/internal/eol"
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/placeholder"
 	"github.com/cr0hn/dockerfile-sec/internal/rules"
-	"github.com/dlclark/regexp2"
 )
 
-// Analyze scans content against rules and returns matched issues.
-// Rules with IDs in ignored are skipped. Invalid regexes are reported to stderr and skipped.
-func Analyze(content string, ruleList []rules.Rule, ignored map[string]bool) []rules.Issue {
-	var issues []rules.Issue
+// Options controls how Analyze reports matches.
+type Options struct {
+	// FirstMatchOnly reports a single issue per rule (its first match) instead
+	// of one issue per occurrence.
+	FirstMatchOnly bool
+	// Target is the stage name or index being built, as in "docker build
+	// --target". Empty means the last stage.
+	Target string
+	// BuildArgs override ARG defaults when expanding variables, as in
+	// "docker build --build-arg".
+	BuildArgs map[string]string
+	// Workers is the number of rules evaluated concurrently. Zero or less
+	// means GOMAXPROCS.
+	Workers int
+	// ScanTimeout bounds the whole scan: Analyze returns when it expires,
+	// reporting the rules still running, and the rules not started yet, as
+	// timed out. Zero means no limit.
+	ScanTimeout time.Duration
+	// Checks are Go checks run after the rules of the set, see LoadChecks.
+	Checks []Check
+	// Now is the scan date, against which end-of-life dates are compared.
+	// Zero means the current time.
+	Now time.Time
+	// EOLCatalog holds the end-of-life dates of base images. Nil means the
+	// embedded catalog, eol.Default().
+	EOLCatalog *eol.Catalog
+	// Entropy holds the thresholds of the entropy checks. Nil means
+	// entropy.DefaultThresholds.
+	Entropy *entropy.Thresholds
+	// Placeholders lists the values secret rules do not report in ENV, ARG
+	// and LABEL assignments. Nil means the embedded allowlist,
+	// placeholder.Default().
+	Placeholders *placeholder.Allowlist
+}
+
+// errDeadline stops a rule evaluation that ran out of time between matches.
+var errDeadline = errors.New("deadline exceeded")
+
+// scan holds the per-Dockerfile state shared by every rule evaluation.
+type scan struct {
+	df *parser.Dockerfile
+	// target is the index of the stage being built, -1 if there are no stages.
+	target int
+	// shipped holds the stages whose layers end up in the target image.
+	shipped map[int]bool
+	// expanded holds the instructions with variables substituted, computed on
+	// first use by a rule with expand set.
+	expanded   []parser.Instruction
+	expandOnce sync.Once
+	buildArgs  map[string]string
+	// factList holds the facts of the parsed (0) and expanded (1)
+	// instructions for when expressions, computed on first use.
+	factList  [2][]map[string]any
+	factsOnce [2]sync.Once
+	// deadline ends the scan, zero if there is no scan timeout.
+	deadline     time.Time
+	scanTimeout  time.Duration
+	now          time.Time
+	eol          *eol.Catalog
+	entropy      entropy.Thresholds
+	placeholders *placeholder.Allowlist
+}
+
+func newScan(df *parser.Dockerfile, opts Options) (*scan, error) {
+	s := &scan{df: df, target: len(df.Stages) - 1, buildArgs: opts.BuildArgs, now: opts.Now, eol: opts.EOLCatalog, placeholders: opts.Placeholders}
+	if s.now.IsZero() {
+		s.now = time.Now()
+	}
+	if s.eol == nil {
+		s.eol = eol.Default()
+	}
+	if s.placeholders == nil {
+		s.placeholders = placeholder.Default()
+	}
+	s.entropy = entropy.DefaultThresholds
+	if opts.Entropy != nil {
+		s.entropy = *opts.Entropy
+	}
+	if opts.ScanTimeout > 0 {
+		s.scanTimeout = opts.ScanTimeout
+		s.deadline = time.Now().Add(opts.ScanTimeout)
+	}
+	if opts.Target != "" {
+		idx, ok := df.StageIndex(opts.Target)
+		if !ok {
+			return nil, fmt.Errorf("unknown target stage: %s", opts.Target)
+		}
+		s.target = idx
+	}
+	s.shipped = df.Lineage(s.target)
+	return s, nil
+}
+
+// inScope reports whether instructions of stage are evaluated for rule.
+func (s *scan) inScope(rule rules.Rule, stage int) bool {
+	return !rule.FinalOnly() || s.shipped[stage]
+}
+
+// stageRef describes stage for an issue, nil for global instructions.
+func (s *scan) stageRef(stage int) *rules.Stage {
+	if stage < 0 || stage >= len(s.df.Stages) {
+		return nil
+	}
+	return &rules.Stage{Index: stage, Name: s.df.Stages[stage].Name, Shipped: s.shipped[stage]}
+}
+
+// Analyze evaluates the rules of set against every instruction of the parsed
+// Dockerfile and returns matched issues. Comments and parser directives are
+// never matched, and continuation lines are joined before matching. By default
+// every occurrence of a rule is reported as its own issue; rules with match
+// "absent" instead report a single issue when they match nowhere. Rules with
+// stages "final" only see the target stage and the stages it is built FROM.
+//
+// The checks in opts.Checks run after the rules. Rules and checks are
+// evaluated concurrently by up to opts.Workers goroutines, and issues are
+// returned in rule order whatever the scheduling. Rules and checks with IDs in
+// ignored are skipped. A rule that runs out of time, its own timeout or the
+// scan's, is reported as a single issue of kind rules.KindTimeout instead of
+// its matches.
+func Analyze(df *parser.Dockerfile, set *rules.RuleSet, ignored map[string]bool, opts Options) ([]rules.Issue, error) {
+	s, err := newScan(df, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Jobs are numbered rules first, then checks.
+	compiled := set.Rules()
+	ruleOf := func(i int) rules.Rule {
+		if i < len(compiled) {
+			return compiled[i].Rule
+		}
+		return opts.Checks[i-len(compiled)].Rule()
+	}
+	total := len(compiled) + len(opts.Checks)
 
-	for _, rule := range ruleList {
-		if ignored[rule.ID] {
+	// Every job is queued up front and reports on the buffered done channel,
+	// so workers stuck in a match past the scan deadline never block and can
+	// be left behind: they stop at their own rule timeout.
+	type result struct {
+		i      int
+		issues []rules.Issue
+		err    error
+	}
+	var (
+		results  = make([][]rules.Issue, total)
+		errs     = make([]error, total)
+		finished = make([]bool, total)
+		jobs     = make(chan int, total)
+		done     = make(chan result, total)
+		pending  int
+	)
+	for i := 0; i < total; i++ {
+		if ignored[ruleOf(i).ID] {
+			finished[i] = true
 			continue
 		}
+		jobs <- i
+		pending++
+	}
+	close(jobs)
 
-		re, err := regexp2.Compile(rule.Regex, regexp2.Multiline)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: invalid regex for rule %s: %v\n", rule.ID, err)
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	for w := 0; w < min(workers, pending); w++ {
+		go func() {
+			for i := range jobs {
+				r := result{i: i}
+				if i < len(compiled) {
+					r.issues, r.err = s.evaluate(compiled[i], opts.FirstMatchOnly)
+				} else {
+					r.issues, r.err = s.runCheck(opts.Checks[i-len(compiled)])
+				}
+				done <- r
+			}
+		}()
+	}
+
+	var expired <-chan time.Time
+	if !s.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(s.deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+wait:
+	for pending > 0 {
+		select {
+		case r := <-done:
+			results[r.i], errs[r.i], finished[r.i] = r.issues, r.err, true
+			pending--
+		case <-expired:
+			break wait
+		}
+	}
+	for i := range finished {
+		if !finished[i] {
+			errs[i] = s.timeoutError(rules.CompiledRule{Rule: ruleOf(i)})
+		}
+	}
+
+	var issues []rules.Issue
+	for i := 0; i < total; i++ {
+		if errs[i] != nil {
+			issue := rules.IssueFromRule(ruleOf(i))
+			issue.Kind = rules.KindTimeout
+			issue.Error = errs[i].Error()
+			issues = append(issues, issue)
 			continue
 		}
+		issues = append(issues, results[i]...)
+	}
 
-		re.MatchTimeout = 5 * time.Second
+	return issues, nil
+}
 
-		match, err := re.MatchString(content)
+// evaluate returns the issues reported by a single rule. The rule may run
+// until its timeout or the scan deadline, whichever comes first; a single
+// regex match is bounded by the rule timeout alone.
+func (s *scan) evaluate(rule rules.CompiledRule, firstMatch bool) ([]rules.Issue, error) {
+	if s.expired() {
+		return nil, s.timeoutError(rule)
+	}
+	deadline := time.Now().Add(rule.Timeout)
+	if !s.deadline.IsZero() && s.deadline.Before(deadline) {
+		deadline = s.deadline
+	}
+
+	var (
+		firstOnly = firstMatch || rule.Absent()
+		found     []rules.Issue
+		err       error
+	)
+	switch {
+	case rule.Matcher != nil:
+		found, err = s.matchCommands(rule, firstOnly, deadline)
+	case rule.Pattern == nil:
+		found, err = s.matchWhen(rule, firstOnly, deadline)
+	default:
+		found, err = s.matchRule(rule, firstOnly, deadline)
+	}
+	if err != nil {
+		// regexp2 only fails on match timeouts, so every error is one.
+		return nil, s.timeoutError(rule)
+	}
+
+	if rule.Absent() {
+		if len(found) == 0 {
+			return []rules.Issue{s.absentIssue(rule.Rule)}, nil
+		}
+		return nil, nil
+	}
+	return found, nil
+}
+
+// matchRule returns one issue per match of the rule's regex across the
+// instructions it applies to, stopping after the first when firstOnly is set.
+// It fails with errDeadline once deadline has passed.
+func (s *scan) matchRule(rule rules.CompiledRule, firstOnly bool, deadline time.Time) ([]rules.Issue, error) {
+	var issues []rules.Issue
+
+	for i, inst := range s.instructions(rule.Rule) {
+		if !s.applies(rule, i, inst) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return issues, errDeadline
+		}
+
+		text, offset := inst.Raw, 0
+		if rule.Scoped() {
+			text, offset = inst.Body, inst.BodyOffset
+		}
+
+		m, err := rule.Pattern.FindStringMatch(text)
+		for ; m != nil && err == nil; m, err = rule.Pattern.FindNextMatch(m) {
+			if rule.Secret && !s.plausibleSecret(inst, offset+m.Index, m.Length) {
+				continue
+			}
+			issue := s.newIssue(rule.Rule, i, inst, offset+m.Index, m.Length, m.String())
+			if issue.Fix, err = s.fixes(rule, i, inst, offset+m.Index, m.Length, m); err != nil {
+				return issues, err
+			}
+			issues = append(issues, issue)
+
+			if firstOnly {
+				return issues, nil
+			}
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: regex timeout/error for rule %s: %v\n", rule.ID, err)
+			return issues, err
+		}
+	}
+
+	return issues, nil
+}
+
+// matchWhen reports every instruction a when-only rule holds for, stopping
+// after the first when firstOnly is set. It fails with errDeadline once
+// deadline has passed.
+func (s *scan) matchWhen(rule rules.CompiledRule, firstOnly bool, deadline time.Time) ([]rules.Issue, error) {
+	var issues []rules.Issue
+
+	for i, inst := range s.instructions(rule.Rule) {
+		if !s.applies(rule, i, inst) {
 			continue
 		}
+		if time.Now().After(deadline) {
+			return issues, errDeadline
+		}
 
-		if match {
-			issues = append(issues, rules.IssueFromRule(rule))
+		length := utf8.RuneCountInString(inst.Raw)
+		issue := s.newIssue(rule.Rule, i, inst, 0, length, inst.Raw)
+		var err error
+		if issue.Fix, err = s.fixes(rule, i, inst, 0, length, nil); err != nil {
+			return issues, err
+		}
+		issues = append(issues, issue)
+		if firstOnly {
+			break
 		}
 	}
 
-	return issues
+	return issues, nil
+}
+
+// applies reports whether rule is evaluated against inst, the i-th
+// instruction: its instruction list, stage scope and when expression all
+// allow it.
+func (s *scan) applies(rule rules.CompiledRule, i int, inst parser.Instruction) bool {
+	if !rule.AppliesTo(inst.Cmd) || !s.inScope(rule.Rule, inst.Stage) {
+		return false
+	}
+	return rule.Condition == nil || rule.Condition.Match(s.facts(rule.Rule)[i])
+}
+
+// expired reports whether the scan deadline has passed.
+func (s *scan) expired() bool {
+	return !s.deadline.IsZero() && !time.Now().Before(s.deadline)
+}
+
+// timeoutError describes why rule ran out of time.
+func (s *scan) timeoutError(rule rules.CompiledRule) error {
+	if s.expired() {
+		return fmt.Errorf("scan timeout of %v exceeded", s.scanTimeout)
+	}
+	return fmt.Errorf("rule timeout of %v exceeded", rule.Timeout)
+}
+
+// instructions returns the instructions rule is evaluated against: the
+// expanded ones for rules with expand set, the parsed ones otherwise.
+func (s *scan) instructions(rule rules.Rule) []parser.Instruction {
+	if !rule.Expand {
+		return s.df.Instructions
+	}
+	s.expandOnce.Do(func() {
+		s.expanded = s.df.Expand(s.buildArgs)
+	})
+	return s.expanded
+}
+
+// newIssue builds the issue for a match of rule at the rune offset index of
+// the i-th instruction, inst being that instruction as evaluated.
+func (s *scan) newIssue(rule rules.Rule, i int, inst parser.Instruction, index, length int, match string) rules.Issue {
+	issue := rules.IssueFromRule(rule)
+	if orig := s.df.Instructions[i]; inst.Raw != orig.Raw {
+		// Offsets into substituted text no longer map to the file, so such
+		// matches are located on the whole instruction.
+		issue.Location = locate(orig, 0, utf8.RuneCountInString(orig.Raw))
+	} else {
+		issue.Location = locate(inst, index, length)
+	}
+	issue.Match = match
+	issue.Stage = s.stageRef(inst.Stage)
+	issue.Image = s.imageRef(inst)
+	return issue
+}
+
+// absentIssue builds the issue for an absence rule that matched nowhere. Rules
+// scoped to the final stage point at the FROM sentence of the target stage.
+func (s *scan) absentIssue(rule rules.Rule) rules.Issue {
+	issue := rules.IssueFromRule(rule)
+	if !rule.FinalOnly() || s.target < 0 {
+		return issue
+	}
+
+	issue.Stage = s.stageRef(s.target)
+	for _, inst := range s.df.Instructions {
+		if inst.Stage == s.target {
+			issue.Location = locate(inst, 0, utf8.RuneCountInString(inst.Raw))
+			break
+		}
+	}
+	return issue
+}
+
+// locate converts a rune-indexed match within inst.Raw into a file location.
+func locate(inst parser.Instruction, index, length int) *rules.Location {
+	loc := &rules.Location{}
+	loc.StartLine, loc.StartColumn = inst.Position(index)
+	if length == 0 {
+		loc.EndLine, loc.EndColumn = loc.StartLine, loc.StartColumn
+		return loc
+	}
+	loc.EndLine, loc.EndColumn = inst.Position(index + length - 1)
+	loc.EndColumn++
+	return loc
 }
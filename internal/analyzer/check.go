@@ -0,0 +1,110 @@
+package analyzer
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cr0hn/dockerfile-sec/internal/entropy"
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// Check is a built-in check written in Go, for conditions that a regex rule
+// cannot express. It sees the whole parsed Dockerfile and shares the ID space
+// of the YAML rules, so it is selected with -R and ignored with -i like them.
+type Check interface {
+	// Rule describes the check. Only its ID, Description, Reference and
+	// Severity are used.
+	Rule() rules.Rule
+	// Run returns the issues found in the Dockerfile of ctx.
+	Run(ctx *Context) []rules.Issue
+}
+
+// builtinChecks holds the Go checks of each built-in rule category, run
+// alongside the category's embedded YAML rules.
+var builtinChecks = map[string][]Check{
+	"core":        {rootUserCheck{}, eolCheck{}, eolCheck{soon: true}},
+	"credentials": {entropyCheck{entropy.Hex}, entropyCheck{entropy.Base64}},
+}
+
+// LoadChecks returns the built-in checks of the categories in selection, which
+// takes the same values as rules.LoadInternal.
+func LoadChecks(selection string) ([]Check, error) {
+	categories, err := rules.SelectCategories(selection)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []Check
+	for _, cat := range categories {
+		checks = append(checks, builtinChecks[cat]...)
+	}
+	return checks, nil
+}
+
+// Context gives a Check access to the Dockerfile being scanned.
+type Context struct {
+	s    *scan
+	rule rules.Rule
+}
+
+// Dockerfile returns the parsed Dockerfile.
+func (c *Context) Dockerfile() *parser.Dockerfile {
+	return c.s.df
+}
+
+// Target returns the index of the stage being built, -1 if there are no
+// stages.
+func (c *Context) Target() int {
+	return c.s.target
+}
+
+// Expanded returns the instructions with ARG and ENV references substituted,
+// in the same order as Dockerfile().Instructions.
+func (c *Context) Expanded() []parser.Instruction {
+	return c.s.instructions(rules.Rule{Expand: true})
+}
+
+// Image returns the image reference of a FROM or COPY --from instruction,
+// nil for other instructions.
+func (c *Context) Image(inst parser.Instruction) *imageref.Reference {
+	return c.s.imageRef(inst)
+}
+
+// Now returns the scan date.
+func (c *Context) Now() time.Time {
+	return c.s.now
+}
+
+// Issue builds an issue of the check for length runes at the rune offset
+// index of the raw text of the i-th instruction.
+func (c *Context) Issue(i, index, length int) rules.Issue {
+	inst := c.s.df.Instructions[i]
+	match := string([]rune(inst.Raw)[index : index+length])
+	return c.s.newIssue(c.rule, i, inst, index, length, match)
+}
+
+// ImageIssue builds an issue of the check for the image ref of the i-th
+// instruction, as returned by Image. It points at the reference when it is
+// written as is, at the whole instruction otherwise (e.g. FROM ${BASE}).
+func (c *Context) ImageIssue(i int, ref *imageref.Reference) rules.Issue {
+	raw := c.s.df.Instructions[i].Raw
+	index, length := 0, utf8.RuneCountInString(raw)
+	if at := strings.Index(raw, ref.Raw); at >= 0 {
+		index, length = utf8.RuneCountInString(raw[:at]), utf8.RuneCountInString(ref.Raw)
+	}
+	issue := c.Issue(i, index, length)
+	issue.Image = ref
+	return issue
+}
+
+// runCheck runs check, unless the scan deadline has already passed.
+func (s *scan) runCheck(check Check) ([]rules.Issue, error) {
+	rule := check.Rule()
+	if s.expired() {
+		return nil, s.timeoutError(rules.CompiledRule{Rule: rule})
+	}
+	return check.Run(&Context{s: s, rule: rule}), nil
+}
@@ -0,0 +1,55 @@
+package analyzer
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+	"github.com/cr0hn/dockerfile-sec/internal/shell"
+)
+
+// matchCommands returns one issue per shell command matching the rule's
+// command matcher in the instructions it applies to, stopping after the first
+// when firstOnly is set. It fails with errDeadline once deadline has passed.
+func (s *scan) matchCommands(rule rules.CompiledRule, firstOnly bool, deadline time.Time) ([]rules.Issue, error) {
+	var issues []rules.Issue
+	m := rule.Matcher
+
+	for i, inst := range s.instructions(rule.Rule) {
+		if !s.applies(rule, i, inst) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return issues, errDeadline
+		}
+
+		// Args is the tail of Body, after the flags.
+		offset := inst.BodyOffset + utf8.RuneCountInString(inst.Body) - utf8.RuneCountInString(inst.Args)
+		cmds := shell.Parse(inst.Args)
+		for j, cmd := range cmds {
+			ok, err := m.Matches(cmd)
+			if err == nil && ok && m.Unless != nil {
+				var later bool
+				later, err = m.Unless.MatchesAny(cmds[j+1:])
+				ok = !later
+			}
+			if err != nil {
+				return issues, err
+			}
+			if !ok {
+				continue
+			}
+
+			issue := s.newIssue(rule.Rule, i, inst, offset+cmd.Start, cmd.End-cmd.Start, cmd.Text)
+			if issue.Fix, err = s.fixes(rule, i, inst, offset+cmd.Start, cmd.End-cmd.Start, nil); err != nil {
+				return issues, err
+			}
+			issues = append(issues, issue)
+			if firstOnly {
+				return issues, nil
+			}
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,175 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cr0hn/dockerfile-sec/internal/entropy"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+	"github.com/cr0hn/dockerfile-sec/internal/shell"
+)
+
+// secretValue finds the values that may hold a secret: the value of a
+// KEY=value assignment or --flag=value argument (group 1 is the key, group 2
+// the value), and quoted strings.
+var secretValue = regexp.MustCompile(`([\w.-]+)=("(?:[^"\\]|\\.)*"|'[^']*'|[^\s"';&|()]*)|"(?:[^"\\]|\\.)*"|'[^']*'`)
+
+// checksumKey matches the names of values that hold checksums or commit
+// hashes, which are random hex strings but not secrets.
+var checksumKey = regexp.MustCompile(`(?i)(sha|md5|checksum|hash|digest|commit|revision)`)
+
+// digestPrefix ends with the algorithm of a digest such as "sha256:" in
+// "python@sha256:...", whose hex string is not a secret.
+var digestPrefix = regexp.MustCompile(`(?i)(sha\d*|md5):$`)
+
+// revisionPrefix ends with the separator of a commit in a URL or git+ spec,
+// as in "git+https://github.com/psf/requests@0e322af..." or
+// "https://example.com/repo.git#0e322af...", whose hex string is not a
+// secret either.
+var revisionPrefix = regexp.MustCompile(`(?i)(://|git\+|git@)\S*(@|#|[?&](rev|ref|commit)=)$`)
+
+// checksumCommands verify or name content by hash, so their hex arguments are
+// not secrets either.
+var checksumCommands = []string{"md5sum", "sha1sum", "sha224sum", "sha256sum", "sha384sum", "sha512sum", "shasum", "git"}
+
+// entropyCheck reports random-looking strings of its charset in the values of
+// ENV, ARG and LABEL and in the assignments and quoted strings of RUN, which
+// catches generated tokens and keys that have no known prefix.
+type entropyCheck struct {
+	charset entropy.Charset
+}
+
+func (c entropyCheck) Rule() rules.Rule {
+	if c.charset == entropy.Hex {
+		return rules.Rule{
+			ID:          "ent-001",
+			Description: "High-entropy hex string, possibly a secret",
+			Reference:   "https://docs.docker.com/build/building/secrets/",
+			Severity:    "Medium",
+			Secret:      true,
+			Remediation: "If the string is a secret, remove it from the Dockerfile and rotate it; provide it with a build secret mount or at run time instead.",
+			ExampleFix: &rules.ExampleFix{
+				Before: "ENV SESSION_KEY=8c1f0e7a9b2d4c6e8f0a1b3c5d7e9f21",
+				After:  "RUN --mount=type=secret,id=session_key ./configure",
+			},
+		}
+	}
+	return rules.Rule{
+		ID:          "ent-002",
+		Description: "High-entropy base64 string, possibly a secret",
+		Reference:   "https://docs.docker.com/build/building/secrets/",
+		Severity:    "Medium",
+		Secret:      true,
+		Remediation: "If the string is a secret, remove it from the Dockerfile and rotate it; provide it with a build secret mount or at run time instead.",
+		ExampleFix: &rules.ExampleFix{
+			Before: "ARG INTERNAL_TOKEN=q8Vd3ZkP0rTnW7xYb2LmC9sHfJ4gA6eU",
+			After:  "RUN --mount=type=secret,id=internal_token ./fetch-deps.sh",
+		},
+	}
+}
+
+func (c entropyCheck) Run(ctx *Context) []rules.Issue {
+	var issues []rules.Issue
+	thresholds := ctx.s.entropy
+
+	for i, inst := range ctx.Dockerfile().Instructions {
+		switch inst.Cmd {
+		case "ENV", "ARG", "LABEL", "RUN":
+		default:
+			continue
+		}
+		if inst.Cmd == "RUN" && c.charset == entropy.Hex && runsChecksumCommand(inst.Args) {
+			continue
+		}
+
+		for _, v := range secretValues(inst.Cmd, inst.Body) {
+			if c.charset == entropy.Hex && checksumKey.MatchString(v.key) {
+				continue
+			}
+			for _, f := range thresholds.Find(inst.Body[v.start:v.end]) {
+				if f.Charset != c.charset {
+					continue
+				}
+				if f.Charset == entropy.Hex && (digestPrefix.MatchString(inst.Body[:v.start+f.Start]) || revisionPrefix.MatchString(inst.Body[v.start:v.start+f.Start])) {
+					continue
+				}
+				start := inst.BodyOffset + utf8.RuneCountInString(inst.Body[:v.start+f.Start])
+				length := utf8.RuneCountInString(inst.Body[v.start+f.Start : v.start+f.End])
+				if !ctx.s.plausibleSecret(inst, start, length) {
+					continue
+				}
+				issue := ctx.Issue(i, start, length)
+				issue.Description = fmt.Sprintf("%s (%.2f bits per character)", issue.Description, f.Entropy)
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues
+}
+
+// value is a candidate secret in the body of an instruction: the byte range
+// of the value, quotes excluded, and the key it is assigned to if any, which
+// starts at keyStart (start for values without a key).
+type value struct {
+	key        string
+	keyStart   int
+	start, end int
+}
+
+// secretValues returns the candidate secrets of the body of a cmd
+// instruction. The legacy "ENV KEY value" and "LABEL key value" forms assign
+// the rest of the body to the first word.
+func secretValues(cmd, body string) []value {
+	if cmd == "ENV" || cmd == "LABEL" {
+		trimmed := strings.TrimLeft(body, " \t")
+		key, _, _ := strings.Cut(trimmed, " ")
+		if key != "" && !strings.Contains(key, "=") && len(key) < len(trimmed) {
+			keyStart := len(body) - len(trimmed)
+			v := unquoted(key, body, keyStart+len(key), len(body))
+			v.keyStart = keyStart
+			return []value{v}
+		}
+	}
+
+	var values []value
+	for _, m := range secretValue.FindAllStringSubmatchIndex(body, -1) {
+		var v value
+		if m[2] >= 0 {
+			v = unquoted(body[m[2]:m[3]], body, m[4], m[5])
+			v.keyStart = m[2]
+		} else {
+			v = unquoted("", body, m[0], m[1])
+			v.keyStart = v.start
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// unquoted returns the value of key at body[start:end], without surrounding
+// whitespace and quotes.
+func unquoted(key, body string, start, end int) value {
+	for start < end && (body[start] == ' ' || body[start] == '\t') {
+		start++
+	}
+	if end-start >= 2 && (body[start] == '"' || body[start] == '\'') && body[end-1] == body[start] {
+		start, end = start+1, end-1
+	}
+	return value{key: key, start: start, end: end}
+}
+
+// runsChecksumCommand reports whether script runs a command of
+// checksumCommands.
+func runsChecksumCommand(script string) bool {
+	for _, cmd := range shell.Parse(script) {
+		for _, name := range checksumCommands {
+			if path.Base(cmd.Name) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
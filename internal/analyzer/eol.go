@@ -0,0 +1,74 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// eolWarning is how long before its end of life a base image is reported by
+// core-014.
+const eolWarning = 90 * 24 * time.Hour
+
+// eolCheck reports FROM images whose release, looked up in the EOL catalog of
+// the scan, has reached its end of life by the scan date (core-013) or
+// reaches it within eolWarning (core-014, soon set).
+type eolCheck struct {
+	soon bool
+}
+
+func (c eolCheck) Rule() rules.Rule {
+	if c.soon {
+		return rules.Rule{
+			ID:          "core-014",
+			Description: "Base image reaches end of life soon and will stop receiving security updates",
+			Reference:   "https://docs.docker.com/build/building/best-practices/#from",
+			Severity:    "Medium",
+			Remediation: "Plan the move to a supported release of the base image before its end of life.",
+			ExampleFix: &rules.ExampleFix{
+				Before: "FROM python:3.9-slim",
+				After:  "FROM python:3.13-slim",
+			},
+		}
+	}
+	return rules.Rule{
+		ID:          "core-013",
+		Description: "Base image has reached end of life and no longer receives security updates",
+		Reference:   "https://docs.docker.com/build/building/best-practices/#from",
+		Severity:    "High",
+		Remediation: "Move to a supported release of the base image; end-of-life images get no more security fixes.",
+		ExampleFix: &rules.ExampleFix{
+			Before: "FROM python:3.7-slim",
+			After:  "FROM python:3.13-slim",
+		},
+	}
+}
+
+func (c eolCheck) Run(ctx *Context) []rules.Issue {
+	var issues []rules.Issue
+	now := ctx.Now()
+
+	for i, inst := range ctx.Expanded() {
+		if inst.Cmd != "FROM" {
+			continue
+		}
+		ref := ctx.Image(inst)
+		if ref == nil {
+			continue
+		}
+		rel, ok := ctx.s.eol.Lookup(*ref)
+		if !ok {
+			continue
+		}
+		left := rel.EOL.Sub(now)
+		if c.soon && (left <= 0 || left > eolWarning) || !c.soon && left > 0 {
+			continue
+		}
+
+		issue := ctx.ImageIssue(i, ref)
+		issue.Description = fmt.Sprintf("%s (%s, end of life %s)", issue.Description, rel, rel.EOL.Format(time.DateOnly))
+		issues = append(issues, issue)
+	}
+	return issues
+}
@@ -0,0 +1,137 @@
+package analyzer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// facts returns the facts of each instruction rule is evaluated against, in
+// the same order, for its When expression. They are computed once per scan
+// for the parsed and for the expanded instructions.
+func (s *scan) facts(rule rules.Rule) []map[string]any {
+	variant := 0
+	if rule.Expand {
+		variant = 1
+	}
+	s.factsOnce[variant].Do(func() {
+		s.factList[variant] = s.buildFacts(s.instructions(rule))
+	})
+	return s.factList[variant]
+}
+
+// buildFacts computes the facts of insts, following the user in effect
+// through each stage and the stages it is built FROM.
+func (s *scan) buildFacts(insts []parser.Instruction) []map[string]any {
+	var (
+		list = make([]map[string]any, len(insts))
+		// users holds the user in effect at the end of each stage so far.
+		users = make(map[int]string)
+	)
+
+	for i, inst := range insts {
+		if inst.Cmd == "FROM" && inst.Stage >= 0 {
+			if base, ok := s.df.BaseStage(inst.Stage); ok {
+				users[inst.Stage] = users[base]
+			}
+		}
+		if inst.Cmd == "USER" && inst.Stage >= 0 {
+			users[inst.Stage] = strings.TrimSpace(inst.Args)
+		}
+
+		flags := make(map[string]any, len(inst.Flags))
+		for _, f := range inst.Flags {
+			flags[f.Name] = f.Value
+		}
+
+		facts := map[string]any{
+			"instruction": inst.Cmd,
+			"args":        inst.Args,
+			"flags":       flags,
+			"stage":       nil,
+			"image":       s.imageFacts(inst),
+			"user":        users[inst.Stage],
+			"ports":       exposedPorts(inst),
+		}
+		if st := s.stageRef(inst.Stage); st != nil {
+			facts["stage"] = map[string]any{"index": int64(st.Index), "name": st.Name, "shipped": st.Shipped}
+		}
+		list[i] = facts
+	}
+	return list
+}
+
+// imageRef returns the image reference of a FROM instruction or of a COPY
+// --from flag, nil for other instructions. References that do not parse
+// (e.g. unexpanded variables) only have Raw set.
+func (s *scan) imageRef(inst parser.Instruction) *imageref.Reference {
+	var ref string
+	switch inst.Cmd {
+	case "FROM":
+		if fields := strings.Fields(inst.Args); len(fields) > 0 {
+			ref = fields[0]
+		}
+	case "COPY":
+		ref, _ = inst.Flag("from")
+	}
+	if ref == "" {
+		return nil
+	}
+
+	isStage := false
+	if inst.Cmd == "FROM" {
+		_, isStage = s.df.BaseStage(inst.Stage)
+	} else {
+		_, isStage = s.df.StageIndex(ref)
+	}
+	if isStage {
+		r := imageref.StageRef(ref)
+		return &r
+	}
+
+	r, err := imageref.Parse(ref)
+	if err != nil {
+		r = imageref.Reference{Raw: ref}
+	}
+	return &r
+}
+
+// imageFacts describes the image of inst for when expressions, nil if it has
+// none.
+func (s *scan) imageFacts(inst parser.Instruction) any {
+	r := s.imageRef(inst)
+	if r == nil {
+		return nil
+	}
+	return map[string]any{
+		"ref":        r.Raw,
+		"registry":   r.Registry,
+		"namespace":  r.Namespace,
+		"name":       r.Name,
+		"repository": r.Repository,
+		"tag":        r.Tag,
+		"digest":     r.Digest,
+		"stage":      r.Stage,
+		"scratch":    r.Scratch(),
+	}
+}
+
+// exposedPorts returns the port numbers listed by an EXPOSE instruction, such
+// as 80 for "80/tcp". Ports that are not numbers (e.g. unexpanded variables)
+// are skipped.
+func exposedPorts(inst parser.Instruction) []any {
+	ports := []any{}
+	if inst.Cmd != "EXPOSE" {
+		return ports
+	}
+	for _, field := range strings.Fields(inst.Args) {
+		port, _, _ := strings.Cut(field, "/")
+		if n, err := strconv.Atoi(port); err == nil {
+			ports = append(ports, int64(n))
+		}
+	}
+	return ports
+}
@@ -0,0 +1,76 @@
+package analyzer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+	"github.com/cr0hn/dockerfile-sec/internal/shell"
+	"github.com/dlclark/regexp2"
+)
+
+// groupRef is a $1 or ${name} reference in Fix.Replace.
+var groupRef = regexp.MustCompile(`\$(\d+|\{\w+\})`)
+
+// fixes returns the edits fixing a match of rule at the rune offset index of
+// the i-th instruction, inst being that instruction as evaluated; m is the
+// regex match, nil for command and when-only rules. It returns nil when the
+// rule has no fix or the match cannot be fixed in place. Matches in the exec
+// (JSON array) form are not rewritten, as text edits would break the array;
+// only their instruction keyword is.
+func (s *scan) fixes(rule rules.CompiledRule, i int, inst parser.Instruction, index, length int, m *regexp2.Match) ([]rules.Edit, error) {
+	fix := rule.Fix
+	if fix == nil || inst.Raw != s.df.Instructions[i].Raw || len(inst.Heredocs) > 0 {
+		return nil, nil
+	}
+	if rule.FixUnless != nil {
+		skip, err := rule.FixUnless.MatchString(inst.Body)
+		if err != nil || skip {
+			return nil, err
+		}
+	}
+
+	var edits []rules.Edit
+	if fix.Instruction != "" {
+		keyword := strings.IndexFunc(inst.Raw, unicode.IsSpace)
+		if keyword < 0 {
+			keyword = len(inst.Raw)
+		}
+		edits = append(edits, rules.Edit{Location: *locate(inst, 0, utf8.RuneCountInString(inst.Raw[:keyword])), Text: fix.Instruction})
+	}
+	if shell.IsExec(inst.Args) {
+		return edits, nil
+	}
+	if fix.Replace != nil {
+		edits = append(edits, rules.Edit{Location: *locate(inst, index, length), Text: expandGroups(*fix.Replace, m)})
+	}
+	if fix.Append != "" {
+		edits = append(edits, rules.Edit{Location: *locate(inst, index+length, 0), Text: fix.Append})
+	}
+	return edits, nil
+}
+
+// expandGroups replaces the group references of tmpl with the text of the
+// groups of m. Unknown groups expand to nothing.
+func expandGroups(tmpl string, m *regexp2.Match) string {
+	return groupRef.ReplaceAllStringFunc(tmpl, func(ref string) string {
+		if m == nil {
+			return ""
+		}
+		name := strings.Trim(ref[1:], "{}")
+		var g *regexp2.Group
+		if n, err := strconv.Atoi(name); err == nil {
+			g = m.GroupByNumber(n)
+		} else {
+			g = m.GroupByName(name)
+		}
+		if g == nil {
+			return ""
+		}
+		return g.String()
+	})
+}
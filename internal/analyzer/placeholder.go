@@ -0,0 +1,74 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/placeholder"
+)
+
+// plausibleSecret reports whether a match of a secret rule, length runes at
+// the rune offset index of inst.Raw, may be a real secret. In ENV, ARG and
+// LABEL it is not when every assignment the match touches has an empty value,
+// a variable reference or a placeholder as value, e.g.
+// ENV DB_PASSWORD=${DB_PASSWORD} or ARG API_KEY=changeme.
+func (s *scan) plausibleSecret(inst parser.Instruction, index, length int) bool {
+	switch inst.Cmd {
+	case "ENV", "ARG", "LABEL":
+	default:
+		return true
+	}
+
+	// Byte offsets of the match within the body.
+	raw := []rune(inst.Raw)
+	body := len(string(raw[:inst.BodyOffset]))
+	start := len(string(raw[:index])) - body
+	end := start + len(string(raw[index:index+length]))
+
+	touched := false
+	for _, a := range assignments(inst.Cmd, inst.Body) {
+		if a.keyStart >= end || max(a.end, a.keyStart+len(a.key)) <= start {
+			continue
+		}
+		touched = true
+		if s.placeholders.Classify(inst.Body[a.start:a.end]) == placeholder.Plausible {
+			return true
+		}
+	}
+	return !touched
+}
+
+// assignments returns the assignments of the body of an ENV, ARG or LABEL
+// instruction, ARG declarations without a default as empty values.
+func assignments(cmd, body string) []value {
+	values := secretValues(cmd, body)
+	if cmd != "ARG" {
+		return values
+	}
+
+	for pos := 0; pos < len(body); {
+		for pos < len(body) && (body[pos] == ' ' || body[pos] == '\t') {
+			pos++
+		}
+		end := pos
+		for end < len(body) && body[end] != ' ' && body[end] != '\t' {
+			end++
+		}
+		word := body[pos:end]
+		if word != "" && !strings.ContainsAny(word, `="'`) && !covered(values, pos) {
+			values = append(values, value{key: word, keyStart: pos, start: end, end: end})
+		}
+		pos = end
+	}
+	return values
+}
+
+// covered reports whether the byte offset pos falls in one of values.
+func covered(values []value, pos int) bool {
+	for _, v := range values {
+		if v.keyStart <= pos && pos < v.end {
+			return true
+		}
+	}
+	return false
+}
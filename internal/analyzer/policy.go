@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/cr0hn/dockerfile-sec/internal/policy"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// PolicyChecks returns the checks enforcing p on every FROM and COPY --from
+// image: pol-001 for images the policy does not allow and pol-002 for images
+// it denies.
+func PolicyChecks(p *policy.Policy) []Check {
+	return []Check{
+		policyCheck{p, policy.NotAllowed, rules.Rule{
+			ID:          "pol-001",
+			Description: "Image is not from an allowed registry or repository",
+			Reference:   "https://docs.docker.com/build/building/best-practices/#from",
+			Severity:    "High",
+			Remediation: "Use an image from an allowed registry, e.g. a mirror of the upstream image, or get the image added to the policy.",
+			ExampleFix: &rules.ExampleFix{
+				Before: "FROM docker.io/library/python:3.12",
+				After:  "FROM registry.example.com/library/python:3.12",
+			},
+		}},
+		policyCheck{p, policy.Denied, rules.Rule{
+			ID:          "pol-002",
+			Description: "Image is denied by policy",
+			Reference:   "https://docs.docker.com/build/building/best-practices/#from",
+			Severity:    "High",
+			Remediation: "Replace the image with one the policy does not deny; the pattern that denies it is given in the description.",
+			ExampleFix: &rules.ExampleFix{
+				Before: "FROM alpine:latest",
+				After:  "FROM alpine:3.20",
+			},
+		}},
+	}
+}
+
+// policyCheck reports the images that get verdict from the policy.
+type policyCheck struct {
+	policy  *policy.Policy
+	verdict policy.Verdict
+	rule    rules.Rule
+}
+
+func (c policyCheck) Rule() rules.Rule {
+	return c.rule
+}
+
+func (c policyCheck) Run(ctx *Context) []rules.Issue {
+	var issues []rules.Issue
+
+	// Images are checked after variable substitution, so FROM ${BASE} is
+	// judged by what it builds from.
+	for i, inst := range ctx.Expanded() {
+		ref := ctx.Image(inst)
+		if ref == nil {
+			continue
+		}
+		verdict, pattern := c.policy.Check(*ref)
+		if verdict != c.verdict {
+			continue
+		}
+
+		issue := ctx.ImageIssue(i, ref)
+		if pattern != "" {
+			issue.Description = fmt.Sprintf("%s (%s)", c.rule.Description, pattern)
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
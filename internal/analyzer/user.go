@@ -0,0 +1,54 @@
+package analyzer
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// rootUserCheck reports a final image whose last USER is root. The image
+// inherits the user of the stage it is built FROM, so the check walks up the
+// stages until it finds a USER; images without any are left to core-001.
+type rootUserCheck struct{}
+
+func (rootUserCheck) Rule() rules.Rule {
+	return rules.Rule{
+		ID:          "core-012",
+		Description: "Last USER of the final image is root. It is recommended to switch to a non-root user",
+		Reference:   "https://docs.docker.com/build/building/best-practices/#user",
+		Severity:    "High",
+		Remediation: "End the final stage with USER set to an unprivileged user; switch back to it after steps that need root.",
+		ExampleFix: &rules.ExampleFix{
+			Before: "USER root\nRUN apt-get install -y --no-install-recommends curl",
+			After:  "USER root\nRUN apt-get install -y --no-install-recommends curl\nUSER app",
+		},
+	}
+}
+
+func (rootUserCheck) Run(ctx *Context) []rules.Issue {
+	df := ctx.Dockerfile()
+	expanded := ctx.Expanded()
+
+	for stage, ok := ctx.Target(), ctx.Target() >= 0; ok; stage, ok = df.BaseStage(stage) {
+		for i := len(expanded) - 1; i >= 0; i-- {
+			inst := expanded[i]
+			if inst.Stage != stage || inst.Cmd != "USER" {
+				continue
+			}
+			if !isRootUser(inst.Args) {
+				return nil
+			}
+			orig := df.Instructions[i]
+			return []rules.Issue{ctx.Issue(i, orig.BodyOffset, utf8.RuneCountInString(orig.Body))}
+		}
+	}
+	return nil
+}
+
+// isRootUser reports whether the argument of a USER instruction ("user",
+// "user:group", "uid" or "uid:gid") selects the root user.
+func isRootUser(arg string) bool {
+	user, _, _ := strings.Cut(strings.TrimSpace(arg), ":")
+	return user == "root" || user == "0"
+}
@@ -0,0 +1,106 @@
+// Package entropy finds random-looking strings, such as generated tokens and
+// keys, by their Shannon entropy.
+package entropy
+
+import "math"
+
+// Charset is the alphabet a random-looking string is drawn from.
+type Charset string
+
+const (
+	// Hex strings only hold hexadecimal digits, e.g. "9f86d081884c7d65".
+	Hex Charset = "hex"
+	// Base64 strings hold letters, digits and + / = - _, e.g.
+	// "dGhpcyBpcyBhIHNlY3JldA==".
+	Base64 Charset = "base64"
+)
+
+// Thresholds are the entropies, in bits per character, from which a string
+// of each charset is reported. A zero threshold disables the charset.
+type Thresholds struct {
+	Hex    float64
+	Base64 float64
+	// MinLength is the length from which strings are considered.
+	MinLength int
+}
+
+// DefaultThresholds are tuned to report generated tokens and keys but not
+// words, paths or identifiers. Random hex strings reach about 3.7 bits per
+// character and random base64 strings about 5 at the minimum length.
+var DefaultThresholds = Thresholds{Hex: 3.0, Base64: 4.5, MinLength: 20}
+
+// Finding is a random-looking run of characters in a string.
+type Finding struct {
+	Charset Charset
+	// Start and End are the byte offsets of the run; End is exclusive.
+	Start, End int
+	Entropy    float64
+}
+
+// Find returns the runs of s made of base64 characters, at least MinLength
+// long, whose entropy reaches the threshold of their charset. A run of hex
+// digits is a hex string unless it has no letter, as numbers are not
+// secrets; any other run is a base64 string.
+func (t Thresholds) Find(s string) []Finding {
+	var findings []Finding
+	for start := 0; start < len(s); {
+		if !isBase64(s[start]) {
+			start++
+			continue
+		}
+		end := start
+		hex, letter := true, false
+		for end < len(s) && isBase64(s[end]) {
+			hex = hex && isHex(s[end])
+			letter = letter || !isDigit(s[end])
+			end++
+		}
+
+		run := s[start:end]
+		charset, threshold := Base64, t.Base64
+		if hex {
+			charset, threshold = Hex, t.Hex
+		}
+		if len(run) >= max(t.MinLength, 1) && threshold > 0 && (!hex || letter) {
+			if e := Shannon(run); e >= threshold {
+				findings = append(findings, Finding{Charset: charset, Start: start, End: end, Entropy: e})
+			}
+		}
+		start = end
+	}
+	return findings
+}
+
+// Shannon returns the Shannon entropy of s in bits per character, counting
+// bytes.
+func Shannon(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var e float64
+	n := float64(len(s))
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+func isBase64(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) ||
+		c == '+' || c == '/' || c == '=' || c == '-' || c == '_'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
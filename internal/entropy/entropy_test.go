@@ -0,0 +1,67 @@
+package entropy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShannon(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"", 0},
+		{"aaaa", 0},
+		{"abab", 1},
+		{"abcd", 2},
+		{"0123456789abcdef", 4},
+	}
+	for _, tt := range tests {
+		if got := Shannon(tt.s); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Shannon(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		charset Charset
+	}{
+		{"8c1f0e7a9b2d4c6e8f0a1b3c5d7e9f21", "8c1f0e7a9b2d4c6e8f0a1b3c5d7e9f21", Hex},
+		{"Bearer q8Vd3ZkP0rTnW7xYb2LmC9sHfJ4gA6eU", "q8Vd3ZkP0rTnW7xYb2LmC9sHfJ4gA6eU", Base64},
+		{"https://example.com/?key=Zm9vYmFyYmF6cXV4MTIzNDU2Nzg5MGFiY2RlZmdo", "key=Zm9vYmFyYmF6cXV4MTIzNDU2Nzg5MGFiY2RlZmdo", Base64},
+		// Too short, numbers, words and paths.
+		{"8c1f0e7a9b2d", "", ""},
+		{"12345678901234567890123456", "", ""},
+		{"Internal build tools and helpers", "", ""},
+		{"/usr/local/lib/python3.12/site-packages", "", ""},
+		{"ThisIsALongCamelCaseIdentifierName", "", ""},
+	}
+	for _, tt := range tests {
+		findings := DefaultThresholds.Find(tt.s)
+		switch {
+		case tt.want == "" && len(findings) > 0:
+			t.Errorf("Find(%q) = %+v, want nothing", tt.s, findings)
+		case tt.want == "":
+		case len(findings) != 1:
+			t.Errorf("Find(%q) = %+v, want %q", tt.s, findings, tt.want)
+		case tt.s[findings[0].Start:findings[0].End] != tt.want || findings[0].Charset != tt.charset:
+			t.Errorf("Find(%q) = %q (%s), want %q (%s)", tt.s, tt.s[findings[0].Start:findings[0].End], findings[0].Charset, tt.want, tt.charset)
+		}
+	}
+}
+
+func TestFindThresholds(t *testing.T) {
+	const token = "8c1f0e7a9b2d4c6e8f0a1b3c5d7e9f21"
+	if got := (Thresholds{Hex: 0, Base64: 4.5, MinLength: 20}).Find(token); len(got) != 0 {
+		t.Errorf("expected a zero hex threshold to disable hex strings, got %+v", got)
+	}
+	if got := (Thresholds{Hex: 3, Base64: 4.5, MinLength: 40}).Find(token); len(got) != 0 {
+		t.Errorf("expected strings under MinLength to be skipped, got %+v", got)
+	}
+	if got := (Thresholds{Hex: 3.95, Base64: 4.5, MinLength: 20}).Find(token); len(got) != 0 {
+		t.Errorf("expected strings under the threshold to be skipped, got %+v", got)
+	}
+}
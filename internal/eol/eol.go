@@ -0,0 +1,139 @@
+// Package eol holds the catalog of base image releases and the dates they
+// reach end of life. The catalog is embedded in the binary and can be
+// replaced by a local file, e.g. a newer copy in an air-gapped environment.
+package eol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+	"github.com/cr0hn/dockerfile-sec/internal/rules/embedded"
+	"gopkg.in/yaml.v3"
+)
+
+// AnyTag is the tag of a release that covers every tag of its image.
+const AnyTag = "*"
+
+// Catalog is a list of releases, as loaded from a file such as:
+//
+//	releases:
+//	  - {image: python, tags: ["3.7"], eol: 2023-06-27}
+//	  - {image: ubuntu, tags: ["16.04", xenial], eol: 2021-04-30}
+//	  - {image: centos, tags: ["*"], eol: 2024-06-30}
+type Catalog struct {
+	Releases []Release `yaml:"releases"`
+}
+
+// Release is a release of an image.
+type Release struct {
+	// Image is the image repository, written as in a FROM instruction.
+	Image string `yaml:"image"`
+	// Tags select the release: a tag matches itself and the more specific
+	// tags starting with it followed by "." or "-", so "3.7" matches
+	// "3.7.17-alpine" but not "3.70". AnyTag matches every tag.
+	Tags []string `yaml:"tags"`
+	// EOL is the day the release stops receiving security updates.
+	EOL time.Time `yaml:"eol"`
+
+	ref imageref.Reference
+}
+
+var defaultCatalog = sync.OnceValue(func() *Catalog {
+	c, err := Parse(embedded.EOLYAML)
+	if err != nil {
+		panic(fmt.Sprintf("embedded EOL catalog: %v", err))
+	}
+	return c
+})
+
+// Default returns the catalog embedded in the binary.
+func Default() *Catalog {
+	return defaultCatalog()
+}
+
+// Load reads a catalog file.
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading EOL catalog %s: %w", path, err)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("EOL catalog %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses and validates a catalog.
+func Parse(data []byte) (*Catalog, error) {
+	c := &Catalog{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty EOL catalog")
+	} else if err != nil {
+		return nil, fmt.Errorf("parsing EOL catalog YAML: %w", err)
+	}
+
+	for i := range c.Releases {
+		rel := &c.Releases[i]
+		ref, err := imageref.Parse(rel.Image)
+		if err != nil {
+			return nil, fmt.Errorf("release %d: %w", i+1, err)
+		}
+		if ref.Tag != "" || ref.Digest != "" {
+			return nil, fmt.Errorf("release %d: image %s must not have a tag or digest", i+1, rel.Image)
+		}
+		if len(rel.Tags) == 0 {
+			return nil, fmt.Errorf("release %d (%s): no tags", i+1, rel.Image)
+		}
+		if rel.EOL.IsZero() {
+			return nil, fmt.Errorf("release %d (%s): missing eol date", i+1, rel.Image)
+		}
+		rel.ref = ref
+	}
+	return c, nil
+}
+
+// Lookup returns the release ref belongs to. References without a tag are
+// only matched by AnyTag releases: "latest" and digests do not say which
+// release they are.
+func (c *Catalog) Lookup(ref imageref.Reference) (Release, bool) {
+	if ref.Stage || ref.Repository == "" {
+		return Release{}, false
+	}
+	for _, rel := range c.Releases {
+		if rel.ref.Registry != ref.Registry || rel.ref.Repository != ref.Repository {
+			continue
+		}
+		for _, tag := range rel.Tags {
+			if tagMatches(tag, ref.Tag) {
+				return rel, true
+			}
+		}
+	}
+	return Release{}, false
+}
+
+// String describes the release, e.g. "python:3.7".
+func (r Release) String() string {
+	if len(r.Tags) == 0 || r.Tags[0] == AnyTag {
+		return r.Image
+	}
+	return r.Image + ":" + r.Tags[0]
+}
+
+func tagMatches(pattern, tag string) bool {
+	if pattern == AnyTag {
+		return true
+	}
+	rest, ok := strings.CutPrefix(tag, pattern)
+	return ok && (rest == "" || rest[0] == '.' || rest[0] == '-')
+}
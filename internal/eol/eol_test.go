@@ -0,0 +1,83 @@
+package eol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+)
+
+func TestLookup(t *testing.T) {
+	c, err := Parse([]byte(`releases:
+  - {image: python, tags: ["3.7"], eol: 2023-06-27}
+  - {image: ubuntu, tags: ["16.04", xenial], eol: 2021-04-30}
+  - {image: centos, tags: ["*"], eol: 2024-06-30}
+  - {image: ghcr.io/acme/base, tags: ["1"], eol: 2025-01-01}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"python:3.7", "python:3.7"},
+		{"python:3.7.17-alpine", "python:3.7"},
+		{"docker.io/library/python:3.7-slim", "python:3.7"},
+		{"python:3.70", ""},
+		{"python:3.12", ""},
+		{"python", ""},
+		{"ubuntu:xenial-20210416", "ubuntu:16.04"},
+		{"centos", "centos"},
+		{"centos:7.9.2009", "centos"},
+		{"ghcr.io/acme/base:1.4", "ghcr.io/acme/base:1"},
+		{"acme/base:1", ""},
+	}
+	for _, tt := range tests {
+		ref, err := imageref.Parse(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, ok := c.Lookup(ref)
+		if got := rel.String(); ok != (tt.want != "") || ok && got != tt.want {
+			t.Errorf("Lookup(%s) = %q %v, want %q", tt.ref, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := c.Lookup(imageref.StageRef("python:3.7")); ok {
+		t.Error("stage references must not be looked up")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	c := Default()
+	if len(c.Releases) == 0 {
+		t.Fatal("embedded catalog has no releases")
+	}
+	ref, _ := imageref.Parse("debian:stretch-slim")
+	if rel, ok := c.Lookup(ref); !ok || rel.EOL.Year() != 2022 {
+		t.Errorf("Lookup(debian:stretch-slim) = %+v %v", rel, ok)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"", "empty EOL catalog"},
+		{"release: []", "field release not found"},
+		{"releases: [{image: python, tags: ['3.7']}]", "missing eol date"},
+		{"releases: [{image: python, eol: 2023-06-27}]", "no tags"},
+		{"releases: [{image: 'python:3', tags: ['3.7'], eol: 2023-06-27}]", "must not have a tag"},
+		{"releases: [{image: Python, tags: ['3.7'], eol: 2023-06-27}]", "invalid repository"},
+		{"releases: [{image: python, tags: ['3.7'], eol: soon}]", "parsing time"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.data, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,601 @@
+// Package expr implements the small expression language of the "when" rule
+// field, e.g. `instruction == "FROM" && image.tag == "latest" && !image.digest`.
+//
+// Expressions are evaluated against an environment of facts: strings, int64
+// numbers, booleans, lists ([]any) and objects (map[string]any). Missing
+// facts and fields evaluate to null, so `!image.digest` holds when there is no
+// digest. Evaluation never fails: operations on values of the wrong type yield
+// null or false.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Expr is a compiled expression. It is safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses src into an Expr.
+func Compile(src string) (*Expr, error) {
+	p := &exprParser{lex: lexer{src: src}}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against env.
+func (e *Expr) Eval(env map[string]any) any {
+	return e.root.eval(env)
+}
+
+// Match reports whether the expression is truthy in env: true, a non-zero
+// number, or a non-empty string, list or object.
+func (e *Expr) Match(env map[string]any) bool {
+	return truthy(e.Eval(env))
+}
+
+// Idents returns the names of the facts the expression refers to, in order of
+// appearance and without duplicates.
+func (e *Expr) Idents() []string {
+	var names []string
+	seen := make(map[string]bool)
+	walk(e.root, func(n node) {
+		if id, ok := n.(identNode); ok && !seen[string(id)] {
+			seen[string(id)] = true
+			names = append(names, string(id))
+		}
+	})
+	return names
+}
+
+// node is an element of the syntax tree.
+type node interface {
+	eval(env map[string]any) any
+}
+
+type (
+	literalNode struct{ value any }
+	identNode   string
+	listNode    []node
+	memberNode  struct {
+		x    node
+		name string
+	}
+	indexNode  struct{ x, index node }
+	notNode    struct{ x node }
+	andNode    struct{ x, y node }
+	orNode     struct{ x, y node }
+	binaryNode struct {
+		op   string
+		x, y node
+	}
+	matchNode struct {
+		x      node
+		re     *regexp.Regexp
+		negate bool
+	}
+	callNode struct {
+		fn   builtin
+		args []node
+	}
+)
+
+func (n literalNode) eval(map[string]any) any { return n.value }
+
+func (n identNode) eval(env map[string]any) any { return normalize(env[string(n)]) }
+
+func (n listNode) eval(env map[string]any) any {
+	list := make([]any, len(n))
+	for i, x := range n {
+		list[i] = x.eval(env)
+	}
+	return list
+}
+
+func (n memberNode) eval(env map[string]any) any {
+	if obj, ok := n.x.eval(env).(map[string]any); ok {
+		return normalize(obj[n.name])
+	}
+	return nil
+}
+
+func (n indexNode) eval(env map[string]any) any {
+	switch x := n.x.eval(env).(type) {
+	case []any:
+		if i, ok := n.index.eval(env).(int64); ok && i >= 0 && i < int64(len(x)) {
+			return normalize(x[i])
+		}
+	case map[string]any:
+		if key, ok := n.index.eval(env).(string); ok {
+			return normalize(x[key])
+		}
+	}
+	return nil
+}
+
+func (n notNode) eval(env map[string]any) any { return !truthy(n.x.eval(env)) }
+
+func (n andNode) eval(env map[string]any) any {
+	return truthy(n.x.eval(env)) && truthy(n.y.eval(env))
+}
+
+func (n orNode) eval(env map[string]any) any {
+	return truthy(n.x.eval(env)) || truthy(n.y.eval(env))
+}
+
+func (n binaryNode) eval(env map[string]any) any {
+	x, y := n.x.eval(env), n.y.eval(env)
+	switch n.op {
+	case "==":
+		return equal(x, y)
+	case "!=":
+		return !equal(x, y)
+	case "in":
+		return contains(y, x)
+	}
+
+	c, ok := compare(x, y)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func (n matchNode) eval(env map[string]any) any {
+	s, ok := n.x.eval(env).(string)
+	if !ok {
+		return false
+	}
+	return n.re.MatchString(s) != n.negate
+}
+
+func (n callNode) eval(env map[string]any) any {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.eval(env)
+	}
+	return n.fn.call(args)
+}
+
+// walk calls fn for n and every node below it.
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case listNode:
+		for _, x := range n {
+			walk(x, fn)
+		}
+	case memberNode:
+		walk(n.x, fn)
+	case indexNode:
+		walk(n.x, fn)
+		walk(n.index, fn)
+	case notNode:
+		walk(n.x, fn)
+	case andNode:
+		walk(n.x, fn)
+		walk(n.y, fn)
+	case orNode:
+		walk(n.x, fn)
+		walk(n.y, fn)
+	case binaryNode:
+		walk(n.x, fn)
+		walk(n.y, fn)
+	case matchNode:
+		walk(n.x, fn)
+	case callNode:
+		for _, a := range n.args {
+			walk(a, fn)
+		}
+	}
+}
+
+// builtin is a function callable from expressions.
+type builtin struct {
+	arity int
+	call  func(args []any) any
+}
+
+var builtins = map[string]builtin{
+	"len": {1, func(args []any) any {
+		switch x := args[0].(type) {
+		case string:
+			return int64(len(x))
+		case []any:
+			return int64(len(x))
+		case map[string]any:
+			return int64(len(x))
+		}
+		return nil
+	}},
+	"lower": {1, stringFunc(strings.ToLower)},
+	"upper": {1, stringFunc(strings.ToUpper)},
+	"startsWith": {2, func(args []any) any {
+		s, ok1 := args[0].(string)
+		prefix, ok2 := args[1].(string)
+		return ok1 && ok2 && strings.HasPrefix(s, prefix)
+	}},
+	"endsWith": {2, func(args []any) any {
+		s, ok1 := args[0].(string)
+		suffix, ok2 := args[1].(string)
+		return ok1 && ok2 && strings.HasSuffix(s, suffix)
+	}},
+	"contains": {2, func(args []any) any {
+		return contains(args[0], args[1])
+	}},
+}
+
+func stringFunc(fn func(string) string) func([]any) any {
+	return func(args []any) any {
+		if s, ok := args[0].(string); ok {
+			return fn(s)
+		}
+		return nil
+	}
+}
+
+// normalize converts Go values supplied in an environment to the types the
+// evaluator works with.
+func normalize(v any) any {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case []string:
+		list := make([]any, len(x))
+		for i, s := range x {
+			list[i] = s
+		}
+		return list
+	case []int:
+		list := make([]any, len(x))
+		for i, n := range x {
+			list[i] = int64(n)
+		}
+		return list
+	case map[string]string:
+		obj := make(map[string]any, len(x))
+		for k, s := range x {
+			obj[k] = s
+		}
+		return obj
+	}
+	return v
+}
+
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	case string:
+		return x != ""
+	case []any:
+		return len(x) > 0
+	case map[string]any:
+		return len(x) > 0
+	}
+	return true
+}
+
+func equal(x, y any) bool {
+	switch a := x.(type) {
+	case []any:
+		b, ok := y.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		return false
+	}
+	if _, ok := y.(map[string]any); ok {
+		return false
+	}
+	if _, ok := y.([]any); ok {
+		return false
+	}
+	return x == y
+}
+
+// contains reports whether container (a list, string or object) holds v: an
+// element, a substring or a key.
+func contains(container, v any) bool {
+	switch c := container.(type) {
+	case []any:
+		for _, e := range c {
+			if equal(e, v) {
+				return true
+			}
+		}
+	case string:
+		s, ok := v.(string)
+		return ok && strings.Contains(c, s)
+	case map[string]any:
+		key, ok := v.(string)
+		if ok {
+			_, found := c[key]
+			return found
+		}
+	}
+	return false
+}
+
+// compare orders two numbers or two strings.
+func compare(x, y any) (int, bool) {
+	switch a := x.(type) {
+	case int64:
+		b, ok := y.(int64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		b, ok := y.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
+
+// exprParser is a recursive descent parser over the tokens of lexer.
+type exprParser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *exprParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("column %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// expect consumes an operator token with text op.
+func (p *exprParser) expect(op string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.tok.kind != tokOp || p.tok.text != op {
+		return p.errorf("expected %q, found %s", op, p.tok)
+	}
+	p.next()
+	return p.err
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	for err == nil && p.isOp("||") {
+		p.next()
+		var y node
+		if y, err = p.parseAnd(); err == nil {
+			x = orNode{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	x, err := p.parseComparison()
+	for err == nil && p.isOp("&&") {
+		p.next()
+		var y node
+		if y, err = p.parseComparison(); err == nil {
+			x = andNode{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseComparison() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isOp("=~", "!~"):
+		op := p.tok.text
+		p.next()
+		if p.err != nil {
+			return nil, p.err
+		}
+		if p.tok.kind != tokString {
+			return nil, p.errorf("expected a string regex after %s, found %s", op, p.tok)
+		}
+		re, err := regexp.Compile(p.tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid regex: %v", err)
+		}
+		p.next()
+		return matchNode{x, re, op == "!~"}, p.err
+	case p.isOp("==", "!=", "<", "<=", ">", ">=") || p.tok.kind == tokIdent && p.tok.text == "in":
+		op := p.tok.text
+		p.next()
+		if p.err != nil {
+			return nil, p.err
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode{op, x, y}, nil
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (node, error) {
+	x, err := p.parsePrimary()
+	for err == nil {
+		switch {
+		case p.isOp("."):
+			p.next()
+			if p.err != nil {
+				return nil, p.err
+			}
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("expected a field name after \".\", found %s", p.tok)
+			}
+			x = memberNode{x, p.tok.text}
+			p.next()
+			err = p.err
+		case p.isOp("["):
+			p.next()
+			var index node
+			if index, err = p.parseOr(); err == nil {
+				err = p.expect("]")
+				x = indexNode{x, index}
+			}
+		default:
+			return x, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return literalNode{tok.num}, p.err
+	case tokString:
+		p.next()
+		return literalNode{tok.text}, p.err
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return literalNode{true}, p.err
+		case "false":
+			return literalNode{false}, p.err
+		case "null":
+			return literalNode{nil}, p.err
+		}
+		if !p.isOp("(") {
+			return identNode(tok.text), p.err
+		}
+		fn, ok := builtins[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("column %d: unknown function %s", tok.pos+1, tok.text)
+		}
+		p.next()
+		args, err := p.parseList(")")
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != fn.arity {
+			return nil, fmt.Errorf("column %d: %s takes %d argument(s), got %d", tok.pos+1, tok.text, fn.arity, len(args))
+		}
+		return callNode{fn, args}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			p.next()
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			p.next()
+			list, err := p.parseList("]")
+			return listNode(list), err
+		}
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// parseList parses comma-separated expressions up to the closing operator.
+func (p *exprParser) parseList(closing string) ([]node, error) {
+	var list []node
+	if p.isOp(closing) {
+		p.next()
+		return list, p.err
+	}
+	for {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, x)
+		if !p.isOp(",") {
+			return list, p.expect(closing)
+		}
+		p.next()
+	}
+}
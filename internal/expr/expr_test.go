@@ -0,0 +1,101 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	env := map[string]any{
+		"instruction": "FROM",
+		"flags":       map[string]string{"platform": "linux/amd64"},
+		"image": map[string]any{
+			"registry":   "docker.io",
+			"repository": "library/python",
+			"tag":        "latest",
+		},
+		"ports": []int{22, 8080},
+		"user":  "",
+		"stage": map[string]any{"index": 1, "name": "app", "shipped": true},
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`instruction == "FROM" && image.tag == "latest" && !image.digest`, true},
+		{`instruction == "FROM" && image.tag == 'latest' && image.digest`, false},
+		{`instruction != "RUN"`, true},
+		{`image.registry == "docker.io" || image.registry == "ghcr.io"`, true},
+		{`!(image.registry == "docker.io")`, false},
+		{`22 in ports`, true},
+		{`23 in ports`, false},
+		{`"platform" in flags && flags.platform =~ "^linux/"`, true},
+		{`flags["platform"] !~ "arm"`, true},
+		{`image.repository in ["library/python", "library/node"]`, true},
+		{`startsWith(image.repository, "library/") && endsWith(image.repository, "python")`, true},
+		{`contains(image.repository, "pyth")`, true},
+		{`lower("ABC") == "abc" && upper(image.tag) == "LATEST"`, true},
+		{`len(ports) == 2 && ports[1] >= 8000`, true},
+		{`stage.index > 0 && stage.index < 2 && stage.shipped`, true},
+		{`stage.name <= "b"`, true},
+		{`!user`, true},
+		{`missing.field == null`, true},
+		{`image.tag > 3`, false},
+		{`ports`, true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.src, err)
+		}
+		if got := e.Match(env); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`instruction ==`, "column 15: unexpected end of expression"},
+		{`instruction == "FROM`, "column 16: unterminated string"},
+		{`(a || b`, `expected ")"`},
+		{`a b`, `unexpected "b"`},
+		{`a =~ b`, "expected a string regex after =~"},
+		{`a =~ "("`, "invalid regex"},
+		{`matches(a)`, "unknown function matches"},
+		{`len(a, b)`, "len takes 1 argument(s), got 2"},
+		{`a # b`, "unexpected character '#'"},
+		{`a.`, `expected a field name after "."`},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestIdents(t *testing.T) {
+	e, err := Compile(`instruction == "FROM" && startsWith(image.ref, "x") && image.tag in tags && !instruction`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Idents(), []string{"instruction", "image", "tags"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Idents() = %v, want %v", got, want)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	e, err := Compile(`a == "say \"hi\"" && b =~ "^\d+\.\d+$"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Match(map[string]any{"a": `say "hi"`, "b": "3.12"}) {
+		t.Errorf("expected escaped quotes and regex backslashes to be kept")
+	}
+}
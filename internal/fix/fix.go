@@ -0,0 +1,238 @@
+// Package fix applies the edits attached to issues to a Dockerfile and renders
+// the result as a unified diff for review.
+package fix
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// span is an edit as byte offsets into the content.
+type span struct {
+	start, end int
+	text       string
+}
+
+// Apply applies the fixes of the unsuppressed issues to content and returns
+// the fixed content and the number of issues fixed. The edits of an issue are
+// applied together or not at all: an issue whose edits overlap those of an
+// earlier issue is left for a later pass, on the issues of the fixed content.
+func Apply(content string, issues []rules.Issue) (string, int) {
+	lines := lineOffsets(content)
+
+	var (
+		spans []span
+		fixed int
+	)
+	for _, issue := range rules.Unsuppressed(issues) {
+		var edits []span
+		for _, e := range issue.Fix {
+			start, ok1 := offset(content, lines, e.Location.StartLine, e.Location.StartColumn)
+			end, ok2 := offset(content, lines, e.Location.EndLine, e.Location.EndColumn)
+			if !ok1 || !ok2 || end < start {
+				edits = nil
+				break
+			}
+			edits = append(edits, span{start, end, e.Text})
+		}
+		if len(edits) == 0 || overlaps(edits, spans) {
+			continue
+		}
+		spans = append(spans, edits...)
+		fixed++
+	}
+
+	// Apply from the end so earlier offsets stay valid.
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	for _, sp := range spans {
+		content = content[:sp.start] + sp.text + content[sp.end:]
+	}
+	return content, fixed
+}
+
+// ApplyEdits applies edits that do not come from issues, each on its own,
+// and returns the edited content and the number of edits applied.
+func ApplyEdits(content string, edits []rules.Edit) (string, int) {
+	issues := make([]rules.Issue, len(edits))
+	for i, e := range edits {
+		issues[i].Fix = []rules.Edit{e}
+	}
+	return Apply(content, issues)
+}
+
+// overlaps reports whether any edit in a overlaps an edit in b. Edits
+// starting at the same offset overlap too, as the order of their texts would
+// be a guess; e.g. a flag inserted after a command and a command appended to
+// it.
+func overlaps(a, b []span) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.start == y.start || x.start < y.end && y.start < x.end ||
+				x.start == x.end && y.start < x.start && x.start < y.end ||
+				y.start == y.end && x.start < y.start && y.start < x.end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lineOffsets returns the byte offset of the start of each line.
+func lineOffsets(content string) []int {
+	offsets := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+// offset converts a 1-based line and rune column into a byte offset of
+// content. Column len+1 is the end of the line.
+func offset(content string, lines []int, line, col int) (int, bool) {
+	if line < 1 || line > len(lines) || col < 1 {
+		return 0, false
+	}
+	start := lines[line-1]
+	end := len(content)
+	if line < len(lines) {
+		end = lines[line] - 1
+	}
+	text := strings.TrimSuffix(content[start:end], "\r")
+	pos := 0
+	for n := 1; n < col; n++ {
+		if pos >= len(text) {
+			return 0, false
+		}
+		_, size := utf8.DecodeRuneInString(text[pos:])
+		pos += size
+	}
+	return start + pos, true
+}
+
+// Diff returns a unified diff turning a into b, with path as the name of both
+// files and three lines of context. It is empty when a and b are equal.
+func Diff(path, a, b string) string {
+	if a == b {
+		return ""
+	}
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:]; Dockerfiles are small enough for the quadratic table.
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type op struct {
+		kind byte // ' ', '-' or '+'
+		text string
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, op{' ', x[i]})
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, op{'+', y[j]})
+			j++
+		default:
+			ops = append(ops, op{'-', x[i]})
+			i++
+		}
+	}
+
+	const context = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+	for start := 0; start < len(ops); {
+		// Find the next change and the extent of its hunk.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		from := max(first-context, start)
+		to := first
+		for k := first; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				to = k + 1
+			} else if k-to >= 2*context {
+				break
+			}
+		}
+		to = min(to+context, len(ops))
+
+		// Line numbers of the hunk start in both files.
+		aLine, bLine := 1, 1
+		for _, o := range ops[:from] {
+			if o.kind != '+' {
+				aLine++
+			}
+			if o.kind != '-' {
+				bLine++
+			}
+		}
+		var aCount, bCount int
+		for _, o := range ops[from:to] {
+			if o.kind != '+' {
+				aCount++
+			}
+			if o.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for _, o := range ops[from:to] {
+			sb.WriteByte(o.kind)
+			sb.WriteString(o.text)
+			if !strings.HasSuffix(o.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits s into lines, keeping their line endings.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,58 @@
+package fix
+
+import (
+	"testing"
+
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+func edit(line, col, endLine, endCol int, text string) rules.Edit {
+	return rules.Edit{Location: rules.Location{StartLine: line, StartColumn: col, EndLine: endLine, EndColumn: endCol}, Text: text}
+}
+
+func TestApply(t *testing.T) {
+	content := "FROM alpine\r\nADD é.txt /\r\nRUN pip install x\n"
+	issues := []rules.Issue{
+		{ID: "rename", Fix: []rules.Edit{edit(2, 1, 2, 4, "COPY")}},
+		{ID: "flag", Fix: []rules.Edit{edit(3, 18, 3, 18, " --no-cache-dir")}},
+		// Same offset as the flag: left for a later pass.
+		{ID: "append", Fix: []rules.Edit{edit(3, 18, 3, 18, " && true")}},
+		{ID: "suppressed", Fix: []rules.Edit{edit(1, 6, 1, 12, "ubuntu")}, Suppressed: &rules.Suppression{Kind: rules.SuppressInline}},
+		{ID: "multibyte", Fix: []rules.Edit{edit(2, 5, 2, 10, "f.txt")}},
+		{ID: "out of range", Fix: []rules.Edit{edit(9, 1, 9, 1, "x")}},
+		{ID: "no fix"},
+	}
+
+	got, n := Apply(content, issues)
+	want := "FROM alpine\r\nCOPY f.txt /\r\nRUN pip install x --no-cache-dir\n"
+	if got != want || n != 3 {
+		t.Errorf("Apply = %q, %d, want %q, 3", got, n, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "FROM alpine\nLABEL a=1\nLABEL b=2\nLABEL c=3\nLABEL d=4\nLABEL e=5\nLABEL f=6\nLABEL g=7\nLABEL h=8\nADD x /\n"
+	b := "FROM alpine:3.20\nLABEL a=1\nLABEL b=2\nLABEL c=3\nLABEL d=4\nLABEL e=5\nLABEL f=6\nLABEL g=7\nLABEL h=8\nCOPY x /"
+	want := `--- a/app/Dockerfile
++++ b/app/Dockerfile
+@@ -1,4 +1,4 @@
+-FROM alpine
++FROM alpine:3.20
+ LABEL a=1
+ LABEL b=2
+ LABEL c=3
+@@ -7,4 +7,4 @@
+ LABEL f=6
+ LABEL g=7
+ LABEL h=8
+-ADD x /
++COPY x /
+\ No newline at end of file
+`
+	if got := Diff("app/Dockerfile", a, b); got != want {
+		t.Errorf("Diff =\n%s\nwant\n%s", got, want)
+	}
+	if got := Diff("Dockerfile", a, a); got != "" {
+		t.Errorf("Diff of equal contents = %q, want empty", got)
+	}
+}
@@ -0,0 +1,152 @@
+package ignore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// commentPrefix starts every suppression comment.
+const commentPrefix = "dockerfile-sec:"
+
+// suppression is a parsed suppression comment covering lines first to last.
+type suppression struct {
+	ids         map[string]bool
+	first, last int
+	rules.Suppression
+}
+
+// Inline holds the suppression comments of a Dockerfile:
+//
+//	# dockerfile-sec:ignore core-004,core-005 reason="vendored tarball"
+//	# dockerfile-sec:ignore-file cred-001 reason="test fixture"
+//
+// "ignore" applies to the instruction directly below the comment (other
+// comments may sit in between) or to the instruction it is placed in when used
+// inside a line continuation. "ignore-file" applies to the whole file.
+type Inline struct {
+	suppressions []suppression
+}
+
+// ParseInline collects the suppression comments of df. Comments in a
+// Dockerfile never fail a scan: malformed suppressions and "ignore" comments
+// not attached to an instruction are skipped and returned as warnings. Other
+// comments starting with "dockerfile-sec:", such as notes, are not
+// suppressions.
+func ParseInline(df *parser.Dockerfile) (*Inline, []error) {
+	commentLines := make(map[int]bool, len(df.Comments))
+	for _, c := range df.Comments {
+		commentLines[c.Line] = true
+	}
+
+	in := &Inline{}
+	var warnings []error
+	for _, c := range df.Comments {
+		if !strings.HasPrefix(c.Text, commentPrefix+"ignore") {
+			continue
+		}
+		kind, rest := cutField(strings.TrimPrefix(c.Text, commentPrefix))
+		ids, reason, err := parseSuppression(rest)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("line %d: %w", c.Line, err))
+			continue
+		}
+
+		s := suppression{ids: ids, Suppression: rules.Suppression{Reason: reason, Line: c.Line}}
+		switch kind {
+		case "ignore":
+			inst, ok := attachedInstruction(df, c.Line, commentLines)
+			if !ok {
+				warnings = append(warnings, fmt.Errorf("line %d: %signore must be placed directly above an instruction", c.Line, commentPrefix))
+				continue
+			}
+			s.Kind = rules.SuppressInline
+			s.first, s.last = inst.StartLine, inst.EndLine
+		case "ignore-file":
+			s.Kind = rules.SuppressFile
+		default:
+			warnings = append(warnings, fmt.Errorf("line %d: unknown suppression %q", c.Line, commentPrefix+kind))
+			continue
+		}
+		in.suppressions = append(in.suppressions, s)
+	}
+	return in, warnings
+}
+
+// Apply marks the issues covered by a suppression comment and returns them.
+// Issues without a location can only be suppressed file-wide.
+func (in *Inline) Apply(issues []rules.Issue) []rules.Issue {
+	for i := range issues {
+		for _, s := range in.suppressions {
+			if s.covers(issues[i]) {
+				suppressed := s.Suppression
+				issues[i].Suppressed = &suppressed
+				break
+			}
+		}
+	}
+	return issues
+}
+
+func (s suppression) covers(issue rules.Issue) bool {
+	if !s.ids[issue.ID] {
+		return false
+	}
+	if s.Kind == rules.SuppressFile {
+		return true
+	}
+	return issue.Location != nil && issue.Location.StartLine >= s.first && issue.Location.StartLine <= s.last
+}
+
+// attachedInstruction returns the instruction a comment on line applies to:
+// the one it sits inside, or the next one if only comments lie in between.
+func attachedInstruction(df *parser.Dockerfile, line int, commentLines map[int]bool) (parser.Instruction, bool) {
+	for _, inst := range df.Instructions {
+		if inst.EndLine < line {
+			continue
+		}
+		for l := line + 1; l < inst.StartLine; l++ {
+			if !commentLines[l] {
+				return parser.Instruction{}, false
+			}
+		}
+		return inst, true
+	}
+	return parser.Instruction{}, false
+}
+
+// parseSuppression parses `id[,id...] [reason="text"]`.
+func parseSuppression(s string) (map[string]bool, string, error) {
+	list, reason, hasReason := strings.Cut(s, "reason=")
+	if hasReason {
+		reason = strings.TrimSpace(reason)
+		if strings.HasPrefix(reason, `"`) {
+			unquoted, err := strconv.Unquote(reason)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid reason %s", reason)
+			}
+			reason = unquoted
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, id := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		ids[id] = true
+	}
+	if len(ids) == 0 {
+		return nil, "", fmt.Errorf("suppression needs at least one rule ID")
+	}
+	return ids, reason, nil
+}
+
+// cutField splits s into its first whitespace-delimited field and the rest.
+func cutField(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
@@ -0,0 +1,106 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+func parseInline(t *testing.T, content string) *Inline {
+	t.Helper()
+	df, err := parser.Parse(content)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	in, warnings := ParseInline(df)
+	if len(warnings) > 0 {
+		t.Fatalf("ParseInline: %v", warnings)
+	}
+	return in
+}
+
+func issueAt(id string, line int) rules.Issue {
+	return rules.Issue{ID: id, Location: &rules.Location{StartLine: line, StartColumn: 1, EndLine: line, EndColumn: 2}}
+}
+
+func TestInlineSuppression(t *testing.T) {
+	content := `FROM alpine
+# dockerfile-sec:ignore core-004,core-007 reason="vendored tarball"
+# another comment
+ADD app.tar.gz /app
+ADD other.tar.gz /other
+RUN apk add curl \
+    # dockerfile-sec:ignore pkg-001
+    && apk add git
+`
+	in := parseInline(t, content)
+	issues := in.Apply([]rules.Issue{
+		issueAt("core-004", 4),
+		issueAt("core-004", 5),
+		issueAt("core-001", 4),
+		issueAt("pkg-001", 8),
+	})
+
+	s := issues[0].Suppressed
+	if s == nil || s.Kind != rules.SuppressInline || s.Reason != "vendored tarball" || s.Line != 2 {
+		t.Errorf("expected inline suppression with reason, got %+v", s)
+	}
+	if issues[1].Suppressed != nil {
+		t.Error("suppression must only cover the instruction below the comment")
+	}
+	if issues[2].Suppressed != nil {
+		t.Error("suppression must only cover the listed rule IDs")
+	}
+	if s := issues[3].Suppressed; s == nil || s.Reason != "" {
+		t.Errorf("expected suppression inside continuation, got %+v", s)
+	}
+}
+
+func TestFileSuppression(t *testing.T) {
+	in := parseInline(t, "FROM alpine\nRUN echo\n# dockerfile-sec:ignore-file cred-001 core-001 reason=fixture\n")
+	issues := in.Apply([]rules.Issue{issueAt("cred-001", 2), {ID: "core-001"}, issueAt("core-002", 1)})
+
+	if s := issues[0].Suppressed; s == nil || s.Kind != rules.SuppressFile || s.Reason != "fixture" {
+		t.Errorf("expected file suppression, got %+v", s)
+	}
+	if issues[1].Suppressed == nil {
+		t.Error("file suppression must cover issues without a location")
+	}
+	if issues[2].Suppressed != nil {
+		t.Error("unexpected suppression of core-002")
+	}
+}
+
+func TestInlineSuppressionWarnings(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"FROM alpine\n# dockerfile-sec:ignore\nRUN echo\n", "at least one rule ID"},
+		{"FROM alpine\n# dockerfile-sec:ignore core-001\n\nRUN echo\n", "directly above an instruction"},
+		{"FROM alpine\nRUN echo\n# dockerfile-sec:ignore core-001\n", "directly above an instruction"},
+		{"FROM alpine\n# dockerfile-sec:ignored core-001\nRUN echo\n", "unknown suppression"},
+		{"FROM alpine\n# dockerfile-sec:ignore core-001 reason=\"open\nRUN echo\n", "invalid reason"},
+	}
+	for _, tt := range tests {
+		df, err := parser.Parse(tt.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in, warnings := ParseInline(df)
+		if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), tt.want) {
+			t.Errorf("%q: expected a warning containing %q, got %v", tt.content, tt.want, warnings)
+		}
+		if len(in.suppressions) != 0 {
+			t.Errorf("%q: expected the comment to be skipped, got %+v", tt.content, in.suppressions)
+		}
+	}
+
+	// Other comments starting with the prefix are notes, not suppressions.
+	in := parseInline(t, "# dockerfile-sec: scanned nightly\nFROM alpine\n# dockerfile-sec:skip core-001\nRUN echo\n")
+	if len(in.suppressions) != 0 {
+		t.Errorf("expected no suppressions, got %+v", in.suppressions)
+	}
+}
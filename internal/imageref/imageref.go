@@ -0,0 +1,131 @@
+// Package imageref parses container image references such as
+// "registry.example.com:5000/team/app:1.0@sha256:..." into their parts,
+// following the rules docker uses to resolve them.
+package imageref
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultRegistry is the registry of references without a registry part.
+const DefaultRegistry = "docker.io"
+
+// Reference is a parsed image reference.
+type Reference struct {
+	// Raw is the reference as written.
+	Raw string `json:"ref"`
+	// Registry is the registry host, with its port if any. It is
+	// DefaultRegistry when the reference names none.
+	Registry string `json:"registry,omitempty"`
+	// Namespace is the repository path before the image name, "library" for
+	// official Docker Hub images, empty for single-component paths on other
+	// registries.
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the last component of the repository path.
+	Name string `json:"name,omitempty"`
+	// Repository is the full repository path: Namespace and Name.
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	// Digest is the content digest, e.g. "sha256:65cb...".
+	Digest string `json:"digest,omitempty"`
+	// Stage is set when the reference names an earlier build stage of the
+	// Dockerfile rather than an image; only Raw is set then.
+	Stage bool `json:"stage,omitempty"`
+}
+
+var (
+	// componentRe is a repository path component.
+	componentRe = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagRe       = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRe    = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+	hostRe      = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9.-]*[a-zA-Z0-9])?(?::[0-9]+)?$|^\[[0-9a-fA-F:]+\](?::[0-9]+)?$`)
+)
+
+// Parse parses ref. The first path component is taken as the registry when
+// it contains a "." or a ":", or is "localhost"; otherwise the image is on
+// DefaultRegistry, where single-component paths are in the "library"
+// namespace.
+func Parse(ref string) (Reference, error) {
+	r := Reference{Raw: ref}
+	if ref == "" {
+		return r, fmt.Errorf("empty image reference")
+	}
+
+	rest := ref
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		if !digestRe.MatchString(digest) {
+			return r, fmt.Errorf("invalid digest %q in image reference %s", digest, ref)
+		}
+		rest, r.Digest = name, digest
+	}
+
+	if first, path, ok := strings.Cut(rest, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		if !hostRe.MatchString(first) {
+			return r, fmt.Errorf("invalid registry %q in image reference %s", first, ref)
+		}
+		r.Registry, rest = first, path
+	} else {
+		r.Registry = DefaultRegistry
+	}
+
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		if !tagRe.MatchString(rest[i+1:]) {
+			return r, fmt.Errorf("invalid tag %q in image reference %s", rest[i+1:], ref)
+		}
+		rest, r.Tag = rest[:i], rest[i+1:]
+	}
+
+	for _, c := range strings.Split(rest, "/") {
+		if !componentRe.MatchString(c) {
+			return r, fmt.Errorf("invalid repository %q in image reference %s", rest, ref)
+		}
+	}
+	if r.Registry == "index.docker.io" {
+		r.Registry = DefaultRegistry
+	}
+	if r.Registry == DefaultRegistry && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+
+	r.Repository = rest
+	if i := strings.LastIndex(rest, "/"); i >= 0 {
+		r.Namespace, r.Name = rest[:i], rest[i+1:]
+	} else {
+		r.Name = rest
+	}
+	return r, nil
+}
+
+// Scratch reports whether the reference is the reserved empty image "scratch".
+func (r Reference) Scratch() bool {
+	return !r.Stage && r.Raw == "scratch"
+}
+
+// Familiar returns the short form docker shows for the reference, without the
+// default registry and "library" namespace.
+func (r Reference) Familiar() string {
+	if r.Stage || r.Repository == "" {
+		return r.Raw
+	}
+	name := r.Repository
+	if r.Registry == DefaultRegistry {
+		name = strings.TrimPrefix(name, "library/")
+	} else {
+		name = r.Registry + "/" + name
+	}
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+	return name
+}
+
+// StageRef returns the Reference of a FROM or COPY --from argument that names
+// a build stage.
+func StageRef(name string) Reference {
+	return Reference{Raw: name, Stage: true}
+}
@@ -0,0 +1,88 @@
+package imageref
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const digest = "sha256:65cb2034c64b4519f1481c552a30ae3fe19f47f3610513b0387dc2e1570080fa"
+
+	tests := []struct {
+		ref  string
+		want Reference
+	}{
+		{"python", Reference{Registry: "docker.io", Namespace: "library", Name: "python", Repository: "library/python"}},
+		{"python:3.12-slim", Reference{Registry: "docker.io", Namespace: "library", Name: "python", Repository: "library/python", Tag: "3.12-slim"}},
+		{"bitnami/redis:7.2", Reference{Registry: "docker.io", Namespace: "bitnami", Name: "redis", Repository: "bitnami/redis", Tag: "7.2"}},
+		{"docker.io/library/alpine:3.20", Reference{Registry: "docker.io", Namespace: "library", Name: "alpine", Repository: "library/alpine", Tag: "3.20"}},
+		{"index.docker.io/alpine", Reference{Registry: "docker.io", Namespace: "library", Name: "alpine", Repository: "library/alpine"}},
+		{"localhost:5000/app", Reference{Registry: "localhost:5000", Name: "app", Repository: "app"}},
+		{"localhost/app:dev", Reference{Registry: "localhost", Name: "app", Repository: "app", Tag: "dev"}},
+		{"registry.example.com:5000/team/sub/app:1.0@" + digest, Reference{Registry: "registry.example.com:5000", Namespace: "team/sub", Name: "app", Repository: "team/sub/app", Tag: "1.0", Digest: digest}},
+		{"ghcr.io/owner/app@" + digest, Reference{Registry: "ghcr.io", Namespace: "owner", Name: "app", Repository: "owner/app", Digest: digest}},
+		{"scratch", Reference{Registry: "docker.io", Namespace: "library", Name: "scratch", Repository: "library/scratch"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.ref)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.ref, err)
+			continue
+		}
+		tt.want.Raw = tt.ref
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"", "empty image reference"},
+		{"Python:3", "invalid repository"},
+		{"python:3@sha256:abc", "invalid digest"},
+		{"python:${TAG}", "invalid tag"},
+		{"${BASE}", "invalid repository"},
+		{"team//app", "invalid repository"},
+		{"reg.example.com:port/app", "invalid registry"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.ref)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.ref, err, tt.want)
+		}
+	}
+}
+
+func TestFamiliar(t *testing.T) {
+	tests := map[string]string{
+		"docker.io/library/python:3.12": "python:3.12",
+		"index.docker.io/bitnami/redis": "bitnami/redis",
+		"ghcr.io/owner/app:1.0":         "ghcr.io/owner/app:1.0",
+	}
+	for ref, want := range tests {
+		r, err := Parse(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Familiar(); got != want {
+			t.Errorf("Familiar(%q) = %q, want %q", ref, got, want)
+		}
+	}
+	if got := StageRef("builder").Familiar(); got != "builder" {
+		t.Errorf("Familiar of a stage = %q", got)
+	}
+}
+
+func TestScratch(t *testing.T) {
+	r, _ := Parse("scratch")
+	if !r.Scratch() {
+		t.Error("expected scratch to be Scratch")
+	}
+	if StageRef("scratch").Scratch() {
+		t.Error("a stage named scratch is not the scratch image")
+	}
+}
@@ -11,50 +11,132 @@ import (
 	"golang.org/x/term"
 )
 
+// Options configures Render.
+type Options struct {
+	// Quiet suppresses the output to stdout; OutputFile is still written.
+	Quiet bool
+	// Verbose follows the table with the remediation of each rule reported;
+	// JSON always includes it.
+	Verbose bool
+	// OutputFile is the path JSON results are written to, if not empty.
+	OutputFile string
+	// NoRedact prints the matched text of secret issues in full instead of
+	// masking it, see Redact.
+	NoRedact bool
+	// Reveal is the number of characters of redacted secrets kept at each end.
+	Reveal int
+}
+
 // Render outputs the analysis results as ASCII table (terminal) or JSON (pipe).
-func Render(issues []rules.Issue, quiet bool, outputFile string) error {
+// Secrets are redacted in every output unless opts.NoRedact is set.
+func Render(issues []rules.Issue, opts Options) error {
+	if !opts.NoRedact {
+		issues = Redact(issues, opts.Reveal)
+	}
+
 	// Write JSON to file if -o specified
-	if outputFile != "" && len(issues) > 0 {
+	if opts.OutputFile != "" && len(issues) > 0 {
 		data, err := json.Marshal(issues)
 		if err != nil {
 			return fmt.Errorf("marshaling JSON: %w", err)
 		}
-		if err := os.WriteFile(outputFile, data, 0644); err != nil {
+		if err := os.WriteFile(opts.OutputFile, data, 0644); err != nil {
 			return fmt.Errorf("writing output file: %w", err)
 		}
 	}
 
-	if quiet {
+	if opts.Quiet {
 		return nil
 	}
 
 	if term.IsTerminal(int(os.Stdout.Fd())) {
-		return renderTable(issues)
+		return renderTable(issues, opts.Verbose)
 	}
 	return renderJSON(issues)
 }
 
-func renderTable(issues []rules.Issue) error {
-	return renderTableTo(os.Stdout, issues)
+func renderTable(issues []rules.Issue, verbose bool) error {
+	return renderTableTo(os.Stdout, issues, verbose)
 }
 
-func renderTableTo(w io.Writer, issues []rules.Issue) error {
-	headers := []string{"Rule Id", "Description", "Severity"}
+func renderTableTo(w io.Writer, issues []rules.Issue, verbose bool) error {
+	headers := []string{"Rule Id", "Description", "Severity", "Location"}
 
-	if len(issues) == 0 {
+	// Suppressed issues are only listed in JSON output, and timed-out rules
+	// are summarized below the table.
+	unsuppressed := rules.Unsuppressed(issues)
+	suppressed := len(issues) - len(unsuppressed)
+
+	var active []rules.Issue
+	var timedOut []string
+	for _, issue := range unsuppressed {
+		if issue.Kind == rules.KindTimeout {
+			timedOut = append(timedOut, issue.ID)
+			continue
+		}
+		active = append(active, issue)
+	}
+
+	if len(active) == 0 {
 		rows := [][]string{{"No issues found"}}
 		printASCIITableTo(w, headers, rows)
-		return nil
+	} else {
+		rows := make([][]string, len(active))
+		for i, issue := range active {
+			rows[i] = []string{issue.ID, issue.Description, issue.Severity, formatLocation(issue.Location)}
+		}
+		printASCIITableTo(w, headers, rows)
+	}
+	if verbose {
+		printRemediationTo(w, active)
 	}
 
-	rows := make([][]string, len(issues))
-	for i, issue := range issues {
-		rows[i] = []string{issue.ID, issue.Description, issue.Severity}
+	if len(timedOut) > 0 {
+		fmt.Fprintf(w, "%d rule(s) timed out and were not fully checked: %s\n", len(timedOut), strings.Join(timedOut, ", "))
+	}
+	if suppressed > 0 {
+		fmt.Fprintf(w, "%d issue(s) suppressed by inline comments\n", suppressed)
 	}
-	printASCIITableTo(w, headers, rows)
 	return nil
 }
 
+// printRemediationTo lists the remediation and example fix of each rule
+// reported in issues, once per rule, in table order.
+func printRemediationTo(w io.Writer, issues []rules.Issue) {
+	seen := make(map[string]bool)
+	for _, issue := range issues {
+		if seen[issue.ID] || issue.Remediation == "" && issue.ExampleFix == nil {
+			continue
+		}
+		seen[issue.ID] = true
+
+		fmt.Fprintf(w, "\n%s: %s\n", issue.ID, issue.Description)
+		if issue.Remediation != "" {
+			fmt.Fprintf(w, "  Remediation: %s\n", issue.Remediation)
+		}
+		if ex := issue.ExampleFix; ex != nil {
+			fmt.Fprintln(w, "  Example fix:")
+			printSnippetTo(w, "-", ex.Before)
+			printSnippetTo(w, "+", ex.After)
+		}
+	}
+}
+
+// printSnippetTo prints each line of snippet indented behind marker.
+func printSnippetTo(w io.Writer, marker, snippet string) {
+	for _, line := range strings.Split(strings.TrimRight(snippet, "\n"), "\n") {
+		fmt.Fprintf(w, "    %s %s\n", marker, line)
+	}
+}
+
+// formatLocation renders an issue location for the table, empty when unknown.
+func formatLocation(loc *rules.Location) string {
+	if loc == nil {
+		return ""
+	}
+	return loc.String()
+}
+
 func printASCIITable(headers []string, rows [][]string) {
 	printASCIITableTo(os.Stdout, headers, rows)
 }
@@ -23,7 +23,7 @@ func TestRenderJSONFile(t *testing.T) {
 	defer os.Remove(tmp.Name())
 
 	// Render with quiet=true so no stdout, but write to file
-	if err := Render(issues, true, tmp.Name()); err != nil {
+	if err := Render(issues, Options{Quiet: true, OutputFile: tmp.Name()}); err != nil {
 		t.Fatalf("Render: %v", err)
 	}
 
@@ -46,7 +46,7 @@ func TestRenderJSONFile(t *testing.T) {
 
 func TestRenderNoIssuesNoFile(t *testing.T) {
 	// Should not error with empty issues
-	if err := Render(nil, true, ""); err != nil {
+	if err := Render(nil, Options{Quiet: true}); err != nil {
 		t.Fatalf("Render: %v", err)
 	}
 }
@@ -56,7 +56,7 @@ func TestRenderQuietSuppressesOutput(t *testing.T) {
 		{ID: "core-001", Description: "Test", Severity: "High"},
 	}
 	// quiet=true, no output file - should not error
-	if err := Render(issues, true, ""); err != nil {
+	if err := Render(issues, Options{Quiet: true}); err != nil {
 		t.Fatalf("Render: %v", err)
 	}
 }
@@ -88,6 +88,12 @@ func TestRenderTableFormat(t *testing.T) {
 				"core-002", "Second", "Medium",
 			},
 		},
+		{
+			name: "issue with location",
+			issues: []rules.Issue{{ID: "core-004", Description: "ADD", Severity: "Low",
+				Location: &rules.Location{StartLine: 12, StartColumn: 1, EndLine: 12, EndColumn: 5}}},
+			contains: []string{"Location", "12:1"},
+		},
 		{
 			name:     "no issues",
 			issues:   nil,
@@ -98,7 +104,7 @@ func TestRenderTableFormat(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			if err := renderTableTo(&buf, tt.issues); err != nil {
+			if err := renderTableTo(&buf, tt.issues, false); err != nil {
 				t.Fatalf("renderTableTo: %v", err)
 			}
 			output := buf.String()
@@ -111,6 +117,90 @@ func TestRenderTableFormat(t *testing.T) {
 	}
 }
 
+func TestRenderTableSuppressed(t *testing.T) {
+	issues := []rules.Issue{
+		{ID: "core-001", Description: "Active", Severity: "High"},
+		{ID: "core-004", Description: "Hidden", Severity: "Low", Suppressed: &rules.Suppression{Kind: rules.SuppressInline, Line: 2}},
+	}
+
+	var buf bytes.Buffer
+	if err := renderTableTo(&buf, issues, false); err != nil {
+		t.Fatalf("renderTableTo: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "core-001") || strings.Contains(output, "core-004") {
+		t.Errorf("expected only unsuppressed issues in table, got:\n%s", output)
+	}
+	if !strings.Contains(output, "1 issue(s) suppressed") {
+		t.Errorf("expected suppressed count, got:\n%s", output)
+	}
+
+	buf.Reset()
+	if err := renderTableTo(&buf, issues[1:], false); err != nil {
+		t.Fatalf("renderTableTo: %v", err)
+	}
+	if !strings.Contains(buf.String(), "No issues found") {
+		t.Errorf("expected no issues when all are suppressed, got:\n%s", buf.String())
+	}
+}
+
+func TestRenderTableTimeout(t *testing.T) {
+	issues := []rules.Issue{
+		{ID: "core-001", Description: "Active", Severity: "High"},
+		{ID: "custom-001", Description: "Slow", Severity: "Low", Kind: rules.KindTimeout, Error: "rule timeout of 1s exceeded"},
+	}
+
+	var buf bytes.Buffer
+	if err := renderTableTo(&buf, issues, false); err != nil {
+		t.Fatalf("renderTableTo: %v", err)
+	}
+	output := buf.String()
+	if strings.Contains(output, "Slow") {
+		t.Errorf("timed-out rules must not be listed as findings, got:\n%s", output)
+	}
+	if !strings.Contains(output, "1 rule(s) timed out and were not fully checked: custom-001") {
+		t.Errorf("expected timed-out rules summary, got:\n%s", output)
+	}
+}
+
+func TestRenderTableVerbose(t *testing.T) {
+	fixed := &rules.ExampleFix{Before: "ADD app.py /app/", After: "COPY app.py /app/"}
+	issues := []rules.Issue{
+		{ID: "core-004", Description: "Use of COPY instead of ADD", Severity: "Low", Remediation: "Use COPY for local files.", ExampleFix: fixed},
+		{ID: "core-004", Description: "Use of COPY instead of ADD", Severity: "Low", Remediation: "Use COPY for local files.", ExampleFix: fixed},
+		{ID: "custom-001", Description: "No guidance", Severity: "Low"},
+	}
+
+	var buf bytes.Buffer
+	if err := renderTableTo(&buf, issues, false); err != nil {
+		t.Fatalf("renderTableTo: %v", err)
+	}
+	if strings.Contains(buf.String(), "Remediation") {
+		t.Errorf("remediation must only be shown in verbose mode, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := renderTableTo(&buf, issues, true); err != nil {
+		t.Fatalf("renderTableTo: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"core-004: Use of COPY instead of ADD\n",
+		"  Remediation: Use COPY for local files.\n",
+		"  Example fix:\n    - ADD app.py /app/\n    + COPY app.py /app/\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nGot:\n%s", want, output)
+		}
+	}
+	if n := strings.Count(output, "Remediation:"); n != 1 {
+		t.Errorf("expected the remediation once per rule, got %d:\n%s", n, output)
+	}
+	if strings.Contains(output, "custom-001:") {
+		t.Errorf("rules without remediation must not be listed, got:\n%s", output)
+	}
+}
+
 func TestRenderJSONFormat(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -153,6 +243,27 @@ func TestRenderJSONFormat(t *testing.T) {
 	}
 }
 
+func TestRenderJSONLocation(t *testing.T) {
+	issues := []rules.Issue{{ID: "core-004", Description: "ADD", Severity: "Low",
+		Location: &rules.Location{StartLine: 3, StartColumn: 1, EndLine: 3, EndColumn: 4}, Match: "ADD"}}
+
+	var buf bytes.Buffer
+	if err := renderJSONTo(&buf, issues); err != nil {
+		t.Fatalf("renderJSONTo: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"location":{"start_line":3,"start_column":1,"end_line":3,"end_column":4}`) {
+		t.Errorf("location missing from JSON: %s", buf.String())
+	}
+
+	var parsed []rules.Issue
+	if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed[0].Location == nil || *parsed[0].Location != *issues[0].Location {
+		t.Errorf("location did not round-trip: %+v", parsed[0].Location)
+	}
+}
+
 func TestPrintASCIITableColumnWidths(t *testing.T) {
 	headers := []string{"ID", "Description"}
 	rows := [][]string{
@@ -204,7 +315,7 @@ func TestRenderEmptyIssuesCreatesEmptyArrayJSON(t *testing.T) {
 	defer os.Remove(tmp.Name())
 
 	// Empty issues should not write to file
-	if err := Render(nil, true, tmp.Name()); err != nil {
+	if err := Render(nil, Options{Quiet: true, OutputFile: tmp.Name()}); err != nil {
 		t.Fatalf("Render: %v", err)
 	}
 
@@ -227,7 +338,7 @@ func TestRenderWritesToFile(t *testing.T) {
 	tmp.Close()
 	defer os.Remove(tmp.Name())
 
-	if err := Render(issues, false, tmp.Name()); err != nil {
+	if err := Render(issues, Options{OutputFile: tmp.Name()}); err != nil {
 		t.Fatalf("Render: %v", err)
 	}
 
@@ -0,0 +1,125 @@
+package output
+
+import (
+	"strings"
+
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// redactedMark replaces the hidden part of a redacted secret. It has a fixed
+// length so the length of the secret is not revealed either.
+const redactedMark = "****"
+
+// Redact returns a copy of issues in which secrets are masked, keeping
+// reveal characters at each end to tell secrets apart. The matched text of
+// secret issues (see rules.Rule.Secret) is masked entirely; in the match of
+// any other issue, the text of the secret issues it overlaps is masked, e.g.
+// the token in the URL of a pip install command. issues is not modified.
+func Redact(issues []rules.Issue, reveal int) []rules.Issue {
+	if issues == nil {
+		return nil
+	}
+	secrets := secretIssues(issues)
+	redacted := make([]rules.Issue, len(issues))
+	for i, issue := range issues {
+		switch {
+		case issue.Match == "":
+		case issue.Secret:
+			issue.Match = mask(issue.Match, reveal)
+		default:
+			runes := []rune(issue.Match)
+			hidden := make([]bool, len(runes))
+			for _, secret := range secrets {
+				hideText(runes, hidden, secret.Match)
+				hideOverlap(issue, hidden, secret)
+			}
+			issue.Match = maskHidden(runes, hidden, reveal)
+		}
+		redacted[i] = issue
+	}
+	return redacted
+}
+
+// RedactText returns text with the matched text of the secret issues among
+// issues masked wherever it appears, as Redact does for matches. It redacts
+// output built from the Dockerfile itself, such as the diff of -fix-diff.
+func RedactText(text string, issues []rules.Issue, reveal int) string {
+	runes := []rune(text)
+	hidden := make([]bool, len(runes))
+	for _, secret := range secretIssues(issues) {
+		hideText(runes, hidden, secret.Match)
+	}
+	return maskHidden(runes, hidden, reveal)
+}
+
+// secretIssues returns the secret issues of issues that have a match.
+func secretIssues(issues []rules.Issue) []rules.Issue {
+	var secrets []rules.Issue
+	for _, issue := range issues {
+		if issue.Secret && issue.Match != "" {
+			secrets = append(secrets, issue)
+		}
+	}
+	return secrets
+}
+
+// hideText marks the runes of every occurrence of secret in runes as hidden.
+func hideText(runes []rune, hidden []bool, secret string) {
+	s := []rune(secret)
+	for i := 0; i+len(s) <= len(runes); i++ {
+		if string(runes[i:i+len(s)]) == secret {
+			for j := i; j < i+len(s); j++ {
+				hidden[j] = true
+			}
+		}
+	}
+}
+
+// hideOverlap marks the runes of the match of issue that the match of secret
+// covers in the Dockerfile, when both are on the same single line. This
+// catches secrets that only partly overlap the match.
+func hideOverlap(issue rules.Issue, hidden []bool, secret rules.Issue) {
+	a, b := issue.Location, secret.Location
+	if a == nil || b == nil || a.StartLine != a.EndLine || b.StartLine != b.EndLine || a.StartLine != b.StartLine {
+		return
+	}
+	for col := max(a.StartColumn, b.StartColumn); col < min(a.EndColumn, b.EndColumn); col++ {
+		if i := col - a.StartColumn; i < len(hidden) {
+			hidden[i] = true
+		}
+	}
+}
+
+// maskHidden returns runes with every run of hidden runes masked.
+func maskHidden(runes []rune, hidden []bool, reveal int) string {
+	var sb strings.Builder
+	for i := 0; i < len(runes); {
+		if !hidden[i] {
+			sb.WriteRune(runes[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(runes) && hidden[end] {
+			end++
+		}
+		sb.WriteString(mask(string(runes[i:end]), reveal))
+		i = end
+	}
+	return sb.String()
+}
+
+// mask hides s but its first and last reveal characters. Secrets shorter
+// than four times reveal are hidden entirely, so that most of a secret is
+// never printed.
+func mask(s string, reveal int) string {
+	runes := []rune(s)
+	if reveal <= 0 || len(runes) < 4*reveal {
+		return redactedMark
+	}
+	var sb strings.Builder
+	sb.WriteString(string(runes[:reveal]))
+	sb.WriteString(redactedMark)
+	sb.WriteString(string(runes[len(runes)-reveal:]))
+	return sb.String()
+}
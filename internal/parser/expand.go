@@ -0,0 +1,343 @@
+package parser
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyValue is a single assignment of an ENV, ARG or LABEL instruction.
+type KeyValue struct {
+	Key string
+	// Value is the assigned value with quotes removed.
+	Value string
+	// HasValue is false for "ARG NAME" declarations without a default.
+	HasValue bool
+}
+
+// KeyValues returns the assignments of an ENV, ARG or LABEL instruction. The
+// legacy "ENV KEY value with spaces" form is returned as a single assignment.
+func (in Instruction) KeyValues() []KeyValue {
+	words := splitWords(in.Args)
+	if len(words) == 0 {
+		return nil
+	}
+
+	if in.Cmd == "ENV" || in.Cmd == "LABEL" {
+		if !strings.Contains(words[0], "=") {
+			key, rest := cutWord(in.Args)
+			return []KeyValue{{Key: key, Value: unquote(rest), HasValue: true}}
+		}
+	}
+
+	var kvs []KeyValue
+	for _, w := range words {
+		key, value, ok := strings.Cut(w, "=")
+		kvs = append(kvs, KeyValue{Key: unquote(key), Value: unquote(value), HasValue: ok})
+	}
+	return kvs
+}
+
+// splitWords splits s on unquoted whitespace, keeping quotes in the words.
+func splitWords(s string) []string {
+	var (
+		words  []string
+		word   strings.Builder
+		quote  rune
+		inWord bool
+		escape bool
+	)
+	for _, r := range s {
+		switch {
+		case escape:
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		}
+		word.WriteRune(r)
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// unquote removes shell-style quoting and backslash escapes from s.
+func unquote(s string) string {
+	var (
+		b      strings.Builder
+		quote  rune
+		escape bool
+	)
+	for _, r := range s {
+		switch {
+		case escape:
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape = true
+			continue
+		case quote != 0 && r == quote:
+			quote = 0
+			continue
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Expand substitutes variable references in s the way Dockerfile instructions
+// do: $VAR, ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:+alt}, ${VAR+alt},
+// ${VAR:?msg} and ${VAR?msg}. Text in single quotes and escaped dollars are
+// left alone. References to variables lookup does not know are kept as
+// written, since RUN commands may rely on variables set by the shell.
+func Expand(s string, lookup func(string) (string, bool)) string {
+	var (
+		b     strings.Builder
+		quote byte
+	)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\' && i+1 < len(s) && s[i+1] == '$':
+			b.WriteByte('$')
+			i += 2
+			continue
+		case c == '$':
+			n, text := expandRef(s[i:], lookup)
+			b.WriteString(text)
+			i += n
+			continue
+		case c == '"':
+			if quote == '"' {
+				quote = 0
+			} else {
+				quote = '"'
+			}
+		case c == '\'' && quote == 0:
+			quote = '\''
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// expandRef expands the reference at the start of s (which begins with '$'),
+// returning the number of bytes consumed and the replacement text.
+func expandRef(s string, lookup func(string) (string, bool)) (int, string) {
+	if len(s) > 1 && s[1] == '{' {
+		end := closingBrace(s)
+		if end < 0 {
+			return 1, "$"
+		}
+		return end + 1, expandBraced(s[:end+1], lookup)
+	}
+
+	n := 1
+	for n < len(s) && isNameByte(s[n], n == 1) {
+		n++
+	}
+	if n == 1 {
+		return 1, "$"
+	}
+	if v, ok := lookup(s[1:n]); ok {
+		return n, v
+	}
+	return n, s[:n]
+}
+
+// expandBraced expands a complete "${...}" reference.
+func expandBraced(ref string, lookup func(string) (string, bool)) string {
+	inner := ref[2 : len(ref)-1]
+	n := 0
+	for n < len(inner) && isNameByte(inner[n], n == 0) {
+		n++
+	}
+	name, rest := inner[:n], inner[n:]
+	if name == "" {
+		return ref
+	}
+	value, set := lookup(name)
+
+	op := rest
+	if len(op) > 2 {
+		op = op[:2]
+	}
+	switch {
+	case rest == "":
+		if set {
+			return value
+		}
+		return ref
+	case op == ":-":
+		if !set || value == "" {
+			return Expand(rest[2:], lookup)
+		}
+		return value
+	case rest[0] == '-':
+		if !set {
+			return Expand(rest[1:], lookup)
+		}
+		return value
+	case op == ":+":
+		if set && value != "" {
+			return Expand(rest[2:], lookup)
+		}
+		return ""
+	case rest[0] == '+':
+		if set {
+			return Expand(rest[1:], lookup)
+		}
+		return ""
+	case op == ":?" || rest[0] == '?':
+		if set {
+			return value
+		}
+	}
+	return ref
+}
+
+// closingBrace returns the index of the brace closing the "${" at the start of
+// s, honouring nested references, or -1.
+func closingBrace(s string) int {
+	depth := 0
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameByte(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// Expand returns a copy of the instructions with ARG and ENV references
+// substituted following Dockerfile scoping: global ARGs (declared before the
+// first FROM) are only visible to FROM lines and to stages that redeclare
+// them, ARGs are scoped to their stage, ENV values are inherited by stages
+// built FROM an earlier stage and take precedence over ARGs of the same name.
+// buildArgs override ARG defaults like "docker build --build-arg".
+//
+// RUN, CMD and ENTRYPOINT are expanded too, approximating the shell that
+// would see ARG and ENV values as environment variables.
+func (df *Dockerfile) Expand(buildArgs map[string]string) []Instruction {
+	var (
+		globals  = make(map[string]string)
+		stageEnv = make([]map[string]string, len(df.Stages))
+		args     map[string]string
+		env      map[string]string
+		out      = make([]Instruction, len(df.Instructions))
+	)
+
+	stageLookup := func(name string) (string, bool) {
+		if v, ok := env[name]; ok {
+			return v, true
+		}
+		v, ok := args[name]
+		return v, ok
+	}
+	globalLookup := func(name string) (string, bool) {
+		v, ok := globals[name]
+		return v, ok
+	}
+
+	for i, inst := range df.Instructions {
+		global := inst.Stage < 0 || inst.Cmd == "FROM"
+		lookup := stageLookup
+		if global {
+			lookup = globalLookup
+		}
+		expanded := expandInstruction(inst, lookup)
+		out[i] = expanded
+
+		switch {
+		case inst.Cmd == "FROM":
+			args = make(map[string]string)
+			env = make(map[string]string)
+			if base, ok := df.BaseStage(inst.Stage); ok {
+				for k, v := range stageEnv[base] {
+					env[k] = v
+				}
+			}
+			stageEnv[inst.Stage] = env
+		case inst.Cmd == "ARG":
+			scope := args
+			if global {
+				scope = globals
+			}
+			for _, kv := range expanded.KeyValues() {
+				switch v, ok := buildArgs[kv.Key]; {
+				case ok:
+					scope[kv.Key] = v
+				case kv.HasValue:
+					scope[kv.Key] = kv.Value
+				case !global:
+					if v, ok := globals[kv.Key]; ok {
+						scope[kv.Key] = v
+					}
+				}
+			}
+		case inst.Cmd == "ENV" && !global:
+			for _, kv := range expanded.KeyValues() {
+				env[kv.Key] = kv.Value
+			}
+		}
+	}
+
+	return out
+}
+
+// expandInstruction substitutes variables in the body, arguments and flags of
+// inst. Positions are kept from the original instruction.
+func expandInstruction(inst Instruction, lookup func(string) (string, bool)) Instruction {
+	prefix := inst.Raw
+	if inst.BodyOffset < utf8.RuneCountInString(inst.Raw) {
+		prefix = string([]rune(inst.Raw)[:inst.BodyOffset])
+	}
+
+	inst.Body = Expand(inst.Body, lookup)
+	inst.Args = Expand(inst.Args, lookup)
+	inst.Raw = prefix + inst.Body
+
+	flags := make([]Flag, len(inst.Flags))
+	for i, f := range inst.Flags {
+		flags[i] = Flag{Name: f.Name, Value: Expand(f.Value, lookup)}
+	}
+	inst.Flags = flags
+
+	return inst
+}
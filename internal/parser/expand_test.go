@@ -0,0 +1,117 @@
+package parser
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"NAME": "app", "EMPTY": "", "TAG": "latest"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"$NAME", "app"},
+		{"${NAME}-bin", "app-bin"},
+		{"python:${TAG}", "python:latest"},
+		{"${MISSING:-default}", "default"},
+		{"${EMPTY:-default}", "default"},
+		{"${EMPTY-default}", ""},
+		{"${MISSING-default}", "default"},
+		{"${NAME:+set}", "set"},
+		{"${EMPTY:+set}", ""},
+		{"${EMPTY+set}", "set"},
+		{"${MISSING+set}", ""},
+		{"${MISSING:-${NAME}}", "app"},
+		{"${NAME:?required}", "app"},
+		{"${MISSING:?required}", "${MISSING:?required}"},
+		{"$MISSING and ${MISSING}", "$MISSING and ${MISSING}"},
+		{`\$NAME`, "$NAME"},
+		{"'$NAME' \"$NAME\"", "'$NAME' \"app\""},
+		{"\"it's $NAME\"", "\"it's app\""},
+		{"cost $5", "cost $5"},
+		{"${unterminated", "${unterminated"},
+	}
+	for _, tt := range tests {
+		if got := Expand(tt.in, lookup); got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []KeyValue
+	}{
+		{"ENV A=1 B=\"two words\" C='$x'", []KeyValue{{"A", "1", true}, {"B", "two words", true}, {"C", "$x", true}}},
+		{"ENV LEGACY value with spaces", []KeyValue{{"LEGACY", "value with spaces", true}}},
+		{"ARG VERSION", []KeyValue{{"VERSION", "", false}}},
+		{"ARG A=1 B", []KeyValue{{"A", "1", true}, {"B", "", false}}},
+		{"LABEL \"com.example.vendor\"=\"ACME Inc\" version=1.0", []KeyValue{{"com.example.vendor", "ACME Inc", true}, {"version", "1.0", true}}},
+	}
+	for _, tt := range tests {
+		df := mustParse(t, tt.content)
+		got := df.Instructions[0].KeyValues()
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.content, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: assignment %d = %+v, want %+v", tt.content, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDockerfileExpand(t *testing.T) {
+	content := `ARG BASE=python:latest
+ARG UNUSED=1
+FROM ${BASE} AS builder
+ARG BASE
+ENV PIP=pip
+RUN $PIP install requests && echo ${UNUSED:-unset}
+FROM builder
+RUN ${PIP:-none} install flask
+ENV PIP=pip3 PY=${PIP}
+RUN echo $PY
+FROM alpine
+RUN echo ${PIP:-none} $BASE
+`
+	df := mustParse(t, content)
+	expanded := df.Expand(nil)
+
+	want := map[int]string{
+		2:  "FROM python:latest AS builder",
+		5:  "RUN pip install requests && echo unset",
+		7:  "RUN pip install flask",
+		9:  "RUN echo pip",
+		11: "RUN echo none $BASE",
+	}
+	for i, raw := range want {
+		if expanded[i].Raw != raw {
+			t.Errorf("instruction %d: Raw = %q, want %q", i, expanded[i].Raw, raw)
+		}
+	}
+	if df.Instructions[2].Raw != "FROM ${BASE} AS builder" {
+		t.Error("Expand must not modify the parsed instructions")
+	}
+	if expanded[2].StartLine != 3 {
+		t.Errorf("expanded instruction lost its position: line %d", expanded[2].StartLine)
+	}
+}
+
+func TestDockerfileExpandBuildArgs(t *testing.T) {
+	df := mustParse(t, "ARG TAG=3.12\nFROM python:${TAG}\nARG MODE=prod\nRUN echo $MODE $UNDECLARED\n")
+	expanded := df.Expand(map[string]string{"TAG": "latest", "MODE": "dev", "UNDECLARED": "x"})
+
+	if expanded[1].Raw != "FROM python:latest" {
+		t.Errorf("FROM = %q", expanded[1].Raw)
+	}
+	if expanded[3].Raw != "RUN echo dev $UNDECLARED" {
+		t.Errorf("RUN = %q", expanded[3].Raw)
+	}
+}
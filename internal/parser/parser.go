@@ -0,0 +1,426 @@
+// Package parser turns Dockerfile source into a typed syntax tree so rules can
+// be evaluated per instruction instead of against the raw file text.
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Directive is a parser directive such as "# syntax=docker/dockerfile:1".
+type Directive struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// Comment is a comment line. Text has the leading "#" and surrounding
+// whitespace removed.
+type Comment struct {
+	Text string
+	Line int
+}
+
+// Flag is an instruction flag such as "--from=builder" or "--mount=type=secret".
+type Flag struct {
+	Name  string
+	Value string
+}
+
+// Instruction is a single logical Dockerfile instruction. Line continuations
+// are joined and comment lines inside them are dropped.
+type Instruction struct {
+	// Cmd is the upper-cased instruction keyword, e.g. "RUN".
+	Cmd   string
+	Flags []Flag
+	// Args is the argument text following the keyword and its flags.
+	Args string
+	// Body is everything after the keyword, flags included, and BodyOffset is
+	// its rune offset within Raw.
+	Body       string
+	BodyOffset int
+	// Raw is the whole logical line as written: keyword, flags and arguments.
+	Raw string
+	// StartLine and EndLine are the 1-based physical lines the instruction spans.
+	StartLine int
+	EndLine   int
+	// Stage is the index of the build stage the instruction belongs to, or -1
+	// for instructions (global ARGs) that precede the first FROM.
+	Stage int
+	// Heredocs holds the here-documents of RUN, COPY and ADD instructions.
+	// Their lines, terminators included, are also part of Raw, separated by
+	// newlines, so rules see them with their own line numbers.
+	Heredocs []Heredoc
+
+	// segments maps rune offsets in Raw back to physical lines and columns.
+	segments []segment
+}
+
+// segment records where a run of Raw starts in the original file.
+type segment struct {
+	offset int
+	line   int
+	col    int
+}
+
+// Position maps a rune offset in Raw to a 1-based line and column in the
+// original file.
+func (in Instruction) Position(offset int) (line, col int) {
+	if len(in.segments) == 0 {
+		return in.StartLine, offset + 1
+	}
+	seg := in.segments[0]
+	for _, s := range in.segments[1:] {
+		if s.offset > offset {
+			break
+		}
+		seg = s
+	}
+	return seg.line, seg.col + offset - seg.offset
+}
+
+// Flag returns the value of the named flag and whether it was present.
+func (in Instruction) Flag(name string) (string, bool) {
+	for _, f := range in.Flags {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Heredoc is a BuildKit here-document such as "RUN <<EOF" or
+// "COPY <<-'EOF' /etc/app.conf".
+type Heredoc struct {
+	// Name is the delimiter, without quotes.
+	Name string
+	// Content is the text between the instruction and the delimiter line,
+	// with leading tabs removed for "<<-" heredocs.
+	Content string
+	// Line is the line of the first content line.
+	Line int
+}
+
+// Stage is a build stage started by a FROM instruction.
+type Stage struct {
+	Index int
+	// Name is the lower-cased "AS" alias, empty if the stage is unnamed.
+	Name string
+	// Image is the base image reference as written in the FROM instruction.
+	Image    string
+	Platform string
+	Line     int
+}
+
+// Dockerfile is the parsed representation of a Dockerfile.
+type Dockerfile struct {
+	Directives   []Directive
+	Instructions []Instruction
+	Stages       []Stage
+	// Comments holds every comment line that is not a parser directive,
+	// including those inside line continuations.
+	Comments []Comment
+}
+
+// Directive returns the value of the named parser directive, if present.
+func (df *Dockerfile) Directive(name string) (string, bool) {
+	for _, d := range df.Directives {
+		if d.Name == name {
+			return d.Value, true
+		}
+	}
+	return "", false
+}
+
+// StageIndex resolves a stage by name or numeric index, as accepted by
+// "docker build --target" and "COPY --from".
+func (df *Dockerfile) StageIndex(ref string) (int, bool) {
+	ref = strings.ToLower(ref)
+	for _, st := range df.Stages {
+		if st.Name != "" && st.Name == ref {
+			return st.Index, true
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 0 && n < len(df.Stages) {
+		return n, true
+	}
+	return -1, false
+}
+
+// BaseStage returns the index of the earlier stage that stage i is built
+// FROM, if its base image refers to a stage rather than an image.
+func (df *Dockerfile) BaseStage(i int) (int, bool) {
+	image := strings.ToLower(df.Stages[i].Image)
+	for j := i - 1; j >= 0; j-- {
+		if df.Stages[j].Name != "" && df.Stages[j].Name == image {
+			return j, true
+		}
+	}
+	return -1, false
+}
+
+// Lineage returns the set of stages whose layers end up in the image built
+// from stage target: the target itself and every stage it is built FROM.
+func (df *Dockerfile) Lineage(target int) map[int]bool {
+	lineage := make(map[int]bool)
+	for i, ok := target, target >= 0 && target < len(df.Stages); ok; i, ok = df.BaseStage(i) {
+		lineage[i] = true
+	}
+	return lineage
+}
+
+var (
+	directiveRe    = regexp.MustCompile(`^#[ \t]*([a-zA-Z][a-zA-Z0-9]*)[ \t]*=[ \t]*(.+?)[ \t]*$`)
+	knownDirective = map[string]bool{"syntax": true, "escape": true, "check": true}
+	// heredocCommands are the instructions BuildKit reads here-documents for.
+	heredocCommands = map[string]bool{"RUN": true, "COPY": true, "ADD": true}
+)
+
+// Parse parses Dockerfile content into a Dockerfile. The escape parser
+// directive selects the line continuation character (backslash or backtick).
+// It returns an error for an invalid escape directive or an unterminated
+// heredoc.
+func Parse(content string) (*Dockerfile, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	df := &Dockerfile{}
+
+	i := parseDirectives(df, lines)
+	escape := `\`
+	if v, ok := df.Directive("escape"); ok {
+		if v != `\` && v != "`" {
+			return nil, fmt.Errorf("invalid escape directive %q: must be \\ or `", v)
+		}
+		escape = v
+	}
+	stage := -1
+
+	for i < len(lines) {
+		trimmed := strings.TrimLeft(lines[i], " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			df.addComment(lines[i], i+1)
+			i++
+			continue
+		}
+
+		start := i
+		var (
+			raw      strings.Builder
+			segments []segment
+			offset   int
+		)
+		line := trimmed
+		col := utf8.RuneCountInString(lines[i]) - utf8.RuneCountInString(trimmed) + 1
+		for {
+			body, continued := cutContinuation(line, escape)
+			segments = append(segments, segment{offset: offset, line: i + 1, col: col})
+			raw.WriteString(body)
+			offset += utf8.RuneCountInString(body)
+			col = 1
+			i++
+			if !continued {
+				break
+			}
+			// Skip comments and blank lines inside a continuation.
+			for i < len(lines) && isBlankOrComment(lines[i]) {
+				df.addComment(lines[i], i+1)
+				i++
+			}
+			if i >= len(lines) {
+				break
+			}
+			line = lines[i]
+		}
+
+		logical := raw.String()
+		keyword, _ := cutWord(logical)
+		var heredocs []Heredoc
+		if heredocCommands[strings.ToUpper(keyword)] {
+			for _, m := range heredocMarkers(logical) {
+				doc := Heredoc{Name: m.name, Line: i + 1}
+				var content strings.Builder
+				for ; i < len(lines); i++ {
+					line := lines[i]
+					if m.strip {
+						line = strings.TrimLeft(line, "\t")
+					}
+					raw.WriteString("\n")
+					offset++
+					segments = append(segments, segment{offset: offset, line: i + 1, col: 1})
+					raw.WriteString(lines[i])
+					offset += utf8.RuneCountInString(lines[i])
+					if line == m.name {
+						break
+					}
+					content.WriteString(line + "\n")
+				}
+				if i >= len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated heredoc %s", start+1, m.name)
+				}
+				i++
+				doc.Content = content.String()
+				heredocs = append(heredocs, doc)
+			}
+		}
+
+		inst := newInstruction(raw.String(), start+1, i)
+		inst.segments = segments
+		inst.Heredocs = heredocs
+		if inst.Cmd == "FROM" {
+			stage = len(df.Stages)
+			df.Stages = append(df.Stages, newStage(inst, stage))
+		}
+		inst.Stage = stage
+		df.Instructions = append(df.Instructions, inst)
+	}
+
+	return df, nil
+}
+
+// parseDirectives consumes the parser directives at the top of the file and
+// returns the index of the first line that is not a directive.
+func parseDirectives(df *Dockerfile, lines []string) int {
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		m := directiveRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			return i
+		}
+		name := strings.ToLower(m[1])
+		if !knownDirective[name] || seen[name] {
+			return i
+		}
+		seen[name] = true
+		df.Directives = append(df.Directives, Directive{Name: name, Value: m[2], Line: i + 1})
+	}
+	return len(lines)
+}
+
+// addComment records line as a comment if it is one.
+func (df *Dockerfile) addComment(line string, number int) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "#") {
+		df.Comments = append(df.Comments, Comment{Text: strings.TrimSpace(trimmed[1:]), Line: number})
+	}
+}
+
+// cutContinuation strips a trailing escape character (and any whitespace after
+// it) from line, reporting whether the instruction continues on the next line.
+func cutContinuation(line, escape string) (string, bool) {
+	trimmed := strings.TrimRight(line, " \t")
+	if strings.HasSuffix(trimmed, escape) {
+		return strings.TrimSuffix(trimmed, escape), true
+	}
+	return line, false
+}
+
+// heredocMarker is a "<<NAME" redirection starting a here-document.
+type heredocMarker struct {
+	name string
+	// strip is set for "<<-", which removes leading tabs from the body.
+	strip bool
+}
+
+// heredocMarkers returns the here-documents opened by an instruction line, in
+// order. Markers inside quotes and "<<<" here-strings are ignored.
+func heredocMarkers(s string) []heredocMarker {
+	var (
+		markers []heredocMarker
+		quote   byte
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(s[i:], "<<<"):
+			i += 2
+		case strings.HasPrefix(s[i:], "<<"):
+			m, n := parseHeredocMarker(s[i+2:])
+			if m.name != "" {
+				markers = append(markers, m)
+			}
+			i += 1 + n
+		}
+	}
+	return markers
+}
+
+// parseHeredocMarker parses the delimiter following "<<", returning the
+// marker (with an empty name if there is none) and the bytes consumed.
+func parseHeredocMarker(s string) (heredocMarker, int) {
+	var m heredocMarker
+	n := 0
+	if strings.HasPrefix(s, "-") {
+		m.strip = true
+		n++
+	}
+	if n < len(s) && (s[n] == '"' || s[n] == '\'') {
+		end := strings.IndexByte(s[n+1:], s[n])
+		if end < 0 {
+			return heredocMarker{}, n
+		}
+		m.name = s[n+1 : n+1+end]
+		return m, n + end + 2
+	}
+	start := n
+	for n < len(s) && isNameByte(s[n], n == start) {
+		n++
+	}
+	m.name = s[start:n]
+	return m, n
+}
+
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+func newInstruction(raw string, startLine, endLine int) Instruction {
+	inst := Instruction{Raw: raw, StartLine: startLine, EndLine: endLine}
+
+	keyword, rest := cutWord(raw)
+	inst.Cmd = strings.ToUpper(keyword)
+	inst.Body = strings.TrimRight(rest, " \t")
+	inst.BodyOffset = utf8.RuneCountInString(raw[:len(raw)-len(rest)])
+
+	for strings.HasPrefix(rest, "--") {
+		var word string
+		word, rest = cutWord(rest)
+		name, value, _ := strings.Cut(strings.TrimPrefix(word, "--"), "=")
+		inst.Flags = append(inst.Flags, Flag{Name: strings.ToLower(name), Value: value})
+	}
+	inst.Args = strings.TrimRight(rest, " \t")
+
+	return inst
+}
+
+// cutWord splits s into its first whitespace-delimited word and the remainder
+// with leading whitespace removed.
+func cutWord(s string) (string, string) {
+	end := strings.IndexAny(s, " \t")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], strings.TrimLeft(s[end:], " \t")
+}
+
+func newStage(from Instruction, index int) Stage {
+	st := Stage{Index: index, Line: from.StartLine}
+	st.Platform, _ = from.Flag("platform")
+
+	fields := strings.Fields(from.Args)
+	if len(fields) > 0 {
+		st.Image = fields[0]
+	}
+	if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+		st.Name = strings.ToLower(fields[2])
+	}
+	return st
+}
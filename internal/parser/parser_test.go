@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, content string) *Dockerfile {
+	t.Helper()
+	df, err := Parse(content)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return df
+}
+
+func TestParseInstructions(t *testing.T) {
+	df := mustParse(t, "FROM ubuntu:20.04\n\n# a comment\nrun echo hi\nEXPOSE 8080\n")
+
+	if len(df.Instructions) != 3 {
+		t.Fatalf("expected 3 instructions, got %d", len(df.Instructions))
+	}
+
+	tests := []struct {
+		cmd  string
+		args string
+		line int
+	}{
+		{"FROM", "ubuntu:20.04", 1},
+		{"RUN", "echo hi", 4},
+		{"EXPOSE", "8080", 5},
+	}
+	for i, tt := range tests {
+		inst := df.Instructions[i]
+		if inst.Cmd != tt.cmd || inst.Args != tt.args || inst.StartLine != tt.line {
+			t.Errorf("instruction %d: got %s %q line %d, want %s %q line %d",
+				i, inst.Cmd, inst.Args, inst.StartLine, tt.cmd, tt.args, tt.line)
+		}
+	}
+}
+
+func TestParseContinuations(t *testing.T) {
+	content := "FROM alpine\nRUN apk update \\\n    # inline comment\n\n    && apk add curl \\  \n    && rm -rf /var/cache/apk/*\nCMD [\"sh\"]\n"
+	df := mustParse(t, content)
+
+	if len(df.Instructions) != 3 {
+		t.Fatalf("expected 3 instructions, got %d", len(df.Instructions))
+	}
+
+	run := df.Instructions[1]
+	want := "RUN apk update     && apk add curl     && rm -rf /var/cache/apk/*"
+	if run.Raw != want {
+		t.Errorf("Raw = %q, want %q", run.Raw, want)
+	}
+	if run.StartLine != 2 || run.EndLine != 6 {
+		t.Errorf("lines = %d-%d, want 2-6", run.StartLine, run.EndLine)
+	}
+	if df.Instructions[2].StartLine != 7 {
+		t.Errorf("CMD line = %d, want 7", df.Instructions[2].StartLine)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	df := mustParse(t, "FROM alpine\nRUN --mount=type=secret,id=npm --network=none npm ci\nCOPY --from=builder /out /app\n")
+
+	run := df.Instructions[1]
+	if len(run.Flags) != 2 {
+		t.Fatalf("expected 2 flags, got %+v", run.Flags)
+	}
+	if v, ok := run.Flag("mount"); !ok || v != "type=secret,id=npm" {
+		t.Errorf("mount flag = %q, %v", v, ok)
+	}
+	if run.Args != "npm ci" {
+		t.Errorf("Args = %q, want %q", run.Args, "npm ci")
+	}
+	if run.Body != "--mount=type=secret,id=npm --network=none npm ci" || run.BodyOffset != 4 {
+		t.Errorf("Body = %q at %d", run.Body, run.BodyOffset)
+	}
+
+	if v, _ := df.Instructions[2].Flag("from"); v != "builder" {
+		t.Errorf("from flag = %q, want builder", v)
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	content := "ARG BASE=alpine\nFROM --platform=linux/amd64 golang:1.22 AS Builder\nRUN go build\nFROM ${BASE}\nCOPY --from=builder /out /app\n"
+	df := mustParse(t, content)
+
+	if len(df.Stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(df.Stages))
+	}
+	if st := df.Stages[0]; st.Name != "builder" || st.Image != "golang:1.22" || st.Platform != "linux/amd64" || st.Line != 2 {
+		t.Errorf("unexpected first stage: %+v", st)
+	}
+	if st := df.Stages[1]; st.Name != "" || st.Image != "${BASE}" || st.Index != 1 {
+		t.Errorf("unexpected second stage: %+v", st)
+	}
+
+	wantStages := []int{-1, 0, 0, 1, 1}
+	for i, inst := range df.Instructions {
+		if inst.Stage != wantStages[i] {
+			t.Errorf("instruction %d (%s) stage = %d, want %d", i, inst.Cmd, inst.Stage, wantStages[i])
+		}
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	df := mustParse(t, "# syntax=docker/dockerfile:1\n# escape=\\\n# not a directive\n# check=skip=all\nFROM alpine\n")
+
+	if v, ok := df.Directive("syntax"); !ok || v != "docker/dockerfile:1" {
+		t.Errorf("syntax directive = %q, %v", v, ok)
+	}
+	if _, ok := df.Directive("escape"); !ok {
+		t.Error("expected escape directive")
+	}
+	if _, ok := df.Directive("check"); ok {
+		t.Error("directives after a regular comment must be ignored")
+	}
+	if len(df.Instructions) != 1 {
+		t.Errorf("expected 1 instruction, got %d", len(df.Instructions))
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	df := mustParse(t, "# syntax=docker/dockerfile:1\nFROM alpine\n  #  first\nRUN a \\\n# inside\n    && b\n")
+
+	want := []Comment{{Text: "first", Line: 3}, {Text: "inside", Line: 5}}
+	if len(df.Comments) != len(want) {
+		t.Fatalf("Comments = %+v, want %+v", df.Comments, want)
+	}
+	for i, c := range want {
+		if df.Comments[i] != c {
+			t.Errorf("comment %d = %+v, want %+v", i, df.Comments[i], c)
+		}
+	}
+}
+
+func TestParseHeredocs(t *testing.T) {
+	content := "FROM alpine\nRUN <<EOF\napk add curl\n# not a comment\nEOF\nCOPY <<-\"CONF\" <<'KEY' /etc/\n\tuser=app\n\tCONF\nsecret\nKEY\nCMD [\"sh\"]\n"
+	df := mustParse(t, content)
+
+	if len(df.Instructions) != 4 {
+		t.Fatalf("expected 4 instructions, got %d", len(df.Instructions))
+	}
+	if len(df.Comments) != 0 {
+		t.Errorf("heredoc lines must not be comments, got %+v", df.Comments)
+	}
+
+	run := df.Instructions[1]
+	if run.Raw != "RUN <<EOF\napk add curl\n# not a comment\nEOF" || run.StartLine != 2 || run.EndLine != 5 {
+		t.Errorf("RUN = %q lines %d-%d", run.Raw, run.StartLine, run.EndLine)
+	}
+	if len(run.Heredocs) != 1 || run.Heredocs[0] != (Heredoc{Name: "EOF", Content: "apk add curl\n# not a comment\n", Line: 3}) {
+		t.Errorf("RUN heredocs = %+v", run.Heredocs)
+	}
+	if line, col := run.Position(strings.Index(run.Raw, "curl")); line != 3 || col != 9 {
+		t.Errorf("Position(curl) = %d:%d, want 3:9", line, col)
+	}
+
+	cp := df.Instructions[2]
+	want := []Heredoc{{Name: "CONF", Content: "user=app\n", Line: 7}, {Name: "KEY", Content: "secret\n", Line: 9}}
+	if len(cp.Heredocs) != 2 || cp.Heredocs[0] != want[0] || cp.Heredocs[1] != want[1] {
+		t.Errorf("COPY heredocs = %+v, want %+v", cp.Heredocs, want)
+	}
+	if cp.EndLine != 10 || df.Instructions[3].StartLine != 11 {
+		t.Errorf("COPY ends on line %d, CMD starts on line %d", cp.EndLine, df.Instructions[3].StartLine)
+	}
+	if line, _ := cp.Position(strings.Index(cp.Raw, "secret")); line != 9 {
+		t.Errorf("Position(secret) line = %d, want 9", line)
+	}
+
+	// Only RUN, COPY and ADD read heredocs, and quoted markers are text.
+	df = mustParse(t, "FROM alpine\nRUN echo \"<<EOF\"\nLABEL x=<<EOF\n")
+	if len(df.Instructions) != 3 || len(df.Instructions[1].Heredocs) != 0 {
+		t.Errorf("unexpected heredocs: %+v", df.Instructions)
+	}
+}
+
+func TestParseEscapeDirective(t *testing.T) {
+	content := "# escape=`\nFROM mcr.microsoft.com/windows/servercore\nRUN dir C:\\ `\n    && echo done\nCOPY app C:\\app\\\nWORKDIR C:\\app\n"
+	df := mustParse(t, content)
+
+	if len(df.Instructions) != 4 {
+		t.Fatalf("expected 4 instructions, got %d: %+v", len(df.Instructions), df.Instructions)
+	}
+	if run := df.Instructions[1]; run.Raw != "RUN dir C:\\     && echo done" || run.EndLine != 4 {
+		t.Errorf("RUN = %q ending on line %d", run.Raw, run.EndLine)
+	}
+	if cp := df.Instructions[2]; cp.Args != "app C:\\app\\" {
+		t.Errorf("backslash must not continue lines, COPY args = %q", cp.Args)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"FROM alpine\nRUN <<EOF\necho hi\n", "line 2: unterminated heredoc EOF"},
+		{"# escape=x\nFROM alpine\n", "invalid escape directive"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.content)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	df := mustParse(t, "")
+	if len(df.Instructions) != 0 || len(df.Stages) != 0 {
+		t.Errorf("expected empty Dockerfile, got %+v", df)
+	}
+}
+
+func TestParseTestdata(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "testdata", "Dockerfile-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		df, err := Parse(string(data))
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		if len(df.Stages) == 0 {
+			t.Errorf("%s: expected at least one stage", f)
+		}
+	}
+}
+
+func TestInstructionPosition(t *testing.T) {
+	df := mustParse(t, "FROM alpine\n  RUN apk update \\\n    && apk add curl\n")
+	run := df.Instructions[1]
+
+	tests := []struct {
+		offset   int
+		line     int
+		col      int
+		describe string
+	}{
+		{0, 2, 3, "keyword on indented first line"},
+		{4, 2, 7, "argument on first line"},
+		{15, 3, 1, "start of continuation line"},
+		{22, 3, 8, "argument on continuation line"},
+	}
+	for _, tt := range tests {
+		line, col := run.Position(tt.offset)
+		if line != tt.line || col != tt.col {
+			t.Errorf("%s: Position(%d) = %d:%d, want %d:%d", tt.describe, tt.offset, line, col, tt.line, tt.col)
+		}
+	}
+}
+
+func TestStageLineage(t *testing.T) {
+	df := mustParse(t, "FROM alpine AS base\nFROM golang AS builder\nFROM base AS app\nFROM app\n")
+
+	if idx, ok := df.StageIndex("Builder"); !ok || idx != 1 {
+		t.Errorf("StageIndex(Builder) = %d, %v", idx, ok)
+	}
+	if idx, ok := df.StageIndex("3"); !ok || idx != 3 {
+		t.Errorf("StageIndex(3) = %d, %v", idx, ok)
+	}
+	if _, ok := df.StageIndex("missing"); ok {
+		t.Error("StageIndex(missing) should fail")
+	}
+
+	if base, ok := df.BaseStage(2); !ok || base != 0 {
+		t.Errorf("BaseStage(2) = %d, %v", base, ok)
+	}
+	if _, ok := df.BaseStage(1); ok {
+		t.Error("stage built from an image has no base stage")
+	}
+
+	lineage := df.Lineage(3)
+	if len(lineage) != 3 || !lineage[0] || !lineage[2] || !lineage[3] || lineage[1] {
+		t.Errorf("Lineage(3) = %v, want stages 0, 2 and 3", lineage)
+	}
+}
@@ -0,0 +1,115 @@
+// Package pin pins the FROM images of a Dockerfile to the digests their tags
+// currently point to, and verifies existing pins.
+package pin
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/rules"
+)
+
+// Resolver resolves the tag of an image reference to a manifest digest.
+type Resolver interface {
+	Digest(ctx context.Context, ref imageref.Reference) (string, error)
+}
+
+// Status is the outcome for one FROM image.
+type Status int
+
+const (
+	// Pinned images had no digest and got the one of their tag.
+	Pinned Status = iota
+	// Verified images have the digest their tag points to.
+	Verified
+	// Stale images have a digest their tag no longer points to.
+	Stale
+	// Skipped images cannot or need not be pinned; Result.Reason says why.
+	Skipped
+	// Failed images could not be resolved; Result.Err says why.
+	Failed
+)
+
+// Result is the outcome for the image of one FROM instruction.
+type Result struct {
+	// Line is the line of the FROM instruction.
+	Line int
+	// Ref is the image as written.
+	Ref    imageref.Reference
+	Status Status
+	// Digest is the digest the tag resolved to, for Pinned, Verified and
+	// Stale images.
+	Digest string
+	Reason string
+	Err    error
+}
+
+// Pin resolves the FROM images of df with r. Images without a digest get
+// the digest of their tag appended ("python:3.12" becomes
+// "python:3.12@sha256:..."), returned as edits of the Dockerfile. With
+// verify set, nothing is edited and images pinned with a tag and a digest are
+// checked instead.
+func Pin(ctx context.Context, df *parser.Dockerfile, r Resolver, verify bool) ([]Result, []rules.Edit) {
+	var (
+		results []Result
+		edits   []rules.Edit
+	)
+	for _, inst := range df.Instructions {
+		fields := strings.Fields(inst.Args)
+		if inst.Cmd != "FROM" || len(fields) == 0 {
+			continue
+		}
+		image := fields[0]
+		res := Result{Line: inst.StartLine, Ref: imageref.Reference{Raw: image}}
+
+		ref, err := imageref.Parse(image)
+		_, stage := df.BaseStage(inst.Stage)
+		switch {
+		case stage:
+			res.Ref, res.Status, res.Reason = imageref.StageRef(image), Skipped, "build stage"
+		case strings.Contains(image, "$"):
+			res.Status, res.Reason = Skipped, "uses build variables"
+		case err != nil:
+			res.Status, res.Err = Failed, err
+		case ref.Scratch():
+			res.Ref, res.Status, res.Reason = ref, Skipped, "scratch"
+		case ref.Digest != "" && !verify:
+			res.Ref, res.Status, res.Reason = ref, Skipped, "already pinned"
+		case ref.Digest != "" && ref.Tag == "":
+			res.Ref, res.Status, res.Reason = ref, Skipped, "no tag to verify against"
+		case ref.Digest == "" && verify:
+			res.Ref, res.Status, res.Reason = ref, Skipped, "not pinned"
+		default:
+			res.Ref = ref
+			res.Digest, res.Err = r.Digest(ctx, ref)
+			switch {
+			case res.Err != nil:
+				res.Status = Failed
+			case !verify:
+				res.Status = Pinned
+				edits = append(edits, pinEdit(inst, image, res.Digest))
+			case res.Digest == ref.Digest:
+				res.Status = Verified
+			default:
+				res.Status = Stale
+			}
+		}
+		results = append(results, res)
+	}
+	return results, edits
+}
+
+// pinEdit inserts "@digest" after the image of a FROM instruction.
+func pinEdit(inst parser.Instruction, image, digest string) rules.Edit {
+	// Args is the tail of Body, after the flags.
+	args := inst.BodyOffset + utf8.RuneCountInString(inst.Body) - utf8.RuneCountInString(inst.Args)
+	lead := utf8.RuneCountInString(inst.Args) - utf8.RuneCountInString(strings.TrimLeft(inst.Args, " \t"))
+	line, col := inst.Position(args + lead + utf8.RuneCountInString(image))
+	return rules.Edit{
+		Location: rules.Location{StartLine: line, StartColumn: col, EndLine: line, EndColumn: col},
+		Text:     "@" + digest,
+	}
+}
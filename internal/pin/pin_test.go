@@ -0,0 +1,123 @@
+package pin
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cr0hn/dockerfile-sec/internal/fix"
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+)
+
+var (
+	digestA = "sha256:" + strings.Repeat("a", 64)
+	digestB = "sha256:" + strings.Repeat("b", 64)
+)
+
+// fakeResolver resolves fully qualified "registry/repository:tag" names.
+type fakeResolver map[string]string
+
+func (f fakeResolver) Digest(_ context.Context, ref imageref.Reference) (string, error) {
+	tag := ref.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	if d, ok := f[ref.Registry+"/"+ref.Repository+":"+tag]; ok {
+		return d, nil
+	}
+	return "", fmt.Errorf("%s: manifest unknown", ref.Raw)
+}
+
+var resolver = fakeResolver{
+	"docker.io/library/golang:1.23":      digestA,
+	"localhost:5000/base/runtime:1":      digestA,
+	"docker.io/library/alpine:latest":    digestB,
+	"registry.example.com/team/app:2.0":  digestB,
+	"docker.io/library/python:3.12-slim": digestB,
+}
+
+func summary(results []Result) []string {
+	var out []string
+	for _, r := range results {
+		s := fmt.Sprintf("%d %s %d", r.Line, r.Ref.Raw, r.Status)
+		if r.Reason != "" {
+			s += " " + r.Reason
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestPin(t *testing.T) {
+	content := `ARG BASE=alpine
+FROM --platform=$BUILDPLATFORM golang:1.23 AS build
+FROM build AS test
+FROM localhost:5000/base/runtime:1
+FROM ${BASE}
+FROM scratch
+FROM python:3.12-slim@` + digestA + `
+FROM unknown/image:1
+FROM \
+    alpine
+`
+	df, err := parser.Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, edits := Pin(context.Background(), df, resolver, false)
+	want := []string{
+		"2 golang:1.23 0",
+		"3 build 3 build stage",
+		"4 localhost:5000/base/runtime:1 0",
+		"5 ${BASE} 3 uses build variables",
+		"6 scratch 3 scratch",
+		"7 python:3.12-slim@" + digestA + " 3 already pinned",
+		"8 unknown/image:1 4",
+		"9 alpine 0",
+	}
+	if got := summary(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("results =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	pinned, n := fix.ApplyEdits(content, edits)
+	wantContent := strings.NewReplacer(
+		"golang:1.23 AS", "golang:1.23@"+digestA+" AS",
+		"runtime:1\n", "runtime:1@"+digestA+"\n",
+		"    alpine\n", "    alpine@"+digestB+"\n",
+	).Replace(content)
+	if n != 3 || pinned != wantContent {
+		t.Errorf("pinned (%d edits) =\n%s\nwant\n%s", n, pinned, wantContent)
+	}
+}
+
+func TestPinVerify(t *testing.T) {
+	df, err := parser.Parse(`FROM golang:1.23@` + digestA + ` AS build
+FROM registry.example.com/team/app:2.0@` + digestA + `
+FROM alpine@` + digestB + `
+FROM python:3.12-slim
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, edits := Pin(context.Background(), df, resolver, true)
+	want := []string{
+		"1 golang:1.23@" + digestA + " 1",
+		"2 registry.example.com/team/app:2.0@" + digestA + " 2",
+		"3 alpine@" + digestB + " 3 no tag to verify against",
+		"4 python:3.12-slim 3 not pinned",
+	}
+	if got := summary(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("results =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if results[1].Digest != digestB {
+		t.Errorf("stale result digest = %s, want the current one %s", results[1].Digest, digestB)
+	}
+	if len(edits) != 0 {
+		t.Errorf("verify must not edit, got %+v", edits)
+	}
+}
@@ -0,0 +1,154 @@
+// Package placeholder tells values that look like real secrets from the
+// values that only stand for one: variable references, empty values and
+// placeholders such as "changeme". The placeholders are an allowlist embedded
+// in the binary, which local files can extend.
+package placeholder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cr0hn/dockerfile-sec/internal/parser"
+	"github.com/cr0hn/dockerfile-sec/internal/rules/embedded"
+	"gopkg.in/yaml.v3"
+)
+
+// Class is the kind of an assigned value.
+type Class int
+
+const (
+	// Plausible values may be real secrets.
+	Plausible Class = iota
+	// Empty values are blank.
+	Empty
+	// Reference values only refer to variables, e.g. ${DB_PASSWORD}, so the
+	// secret is provided at build or run time.
+	Reference
+	// Placeholder values are on the allowlist, e.g. changeme or <token>.
+	Placeholder
+)
+
+func (c Class) String() string {
+	switch c {
+	case Empty:
+		return "empty"
+	case Reference:
+		return "reference"
+	case Placeholder:
+		return "placeholder"
+	}
+	return "plausible"
+}
+
+// Allowlist lists the placeholder values, as loaded from a file such as:
+//
+//	values: [changeme, dummy]
+//	patterns: ['<[^<>]*>', '(?i)x{3,}']
+type Allowlist struct {
+	// Values are compared with values ignoring case.
+	Values []string `yaml:"values"`
+	// Patterns are regular expressions that must match the whole value.
+	Patterns []string `yaml:"patterns"`
+
+	patterns []*regexp.Regexp
+}
+
+var defaultAllowlist = sync.OnceValue(func() *Allowlist {
+	a, err := Parse(embedded.PlaceholdersYAML)
+	if err != nil {
+		panic(fmt.Sprintf("embedded placeholder allowlist: %v", err))
+	}
+	return a
+})
+
+// Default returns the allowlist embedded in the binary.
+func Default() *Allowlist {
+	return defaultAllowlist()
+}
+
+// Load reads an allowlist file.
+func Load(path string) (*Allowlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading placeholder allowlist %s: %w", path, err)
+	}
+	a, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("placeholder allowlist %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Parse parses and validates an allowlist.
+func Parse(data []byte) (*Allowlist, error) {
+	a := &Allowlist{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(a); errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty placeholder allowlist")
+	} else if err != nil {
+		return nil, fmt.Errorf("parsing placeholder allowlist YAML: %w", err)
+	}
+
+	for _, p := range a.Patterns {
+		re, err := regexp.Compile(`^(?:` + p + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		a.patterns = append(a.patterns, re)
+	}
+	return a, nil
+}
+
+// Extend returns an allowlist with the values and patterns of a and b.
+func (a *Allowlist) Extend(b *Allowlist) *Allowlist {
+	return &Allowlist{
+		Values:   append(append([]string(nil), a.Values...), b.Values...),
+		Patterns: append(append([]string(nil), a.Patterns...), b.Patterns...),
+		patterns: append(append([]*regexp.Regexp(nil), a.patterns...), b.patterns...),
+	}
+}
+
+// Classify returns the class of an assigned value, with quotes removed. The
+// defaults of references (${TOKEN:-changeme}) and text around them are
+// classified like values, so ${TOKEN:-s3cr3t} is plausible.
+func (a *Allowlist) Classify(value string) Class {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Empty
+	}
+	if strings.Contains(value, "$") {
+		// Keep the defaults of unset variables, then drop what is left.
+		literal := parser.Expand(value, func(string) (string, bool) { return "", false })
+		literal = strings.TrimSpace(parser.Expand(literal, func(string) (string, bool) { return "", true }))
+		if literal == "" {
+			return Reference
+		}
+		value = literal
+	}
+	if a.allowed(value) {
+		return Placeholder
+	}
+	return Plausible
+}
+
+// allowed reports whether value is on the allowlist.
+func (a *Allowlist) allowed(value string) bool {
+	for _, v := range a.Values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	for _, re := range a.patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
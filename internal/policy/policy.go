@@ -0,0 +1,190 @@
+// Package policy decides which images a Dockerfile may build FROM or copy
+// from, based on a YAML file of allowed registries and allowed and denied
+// image patterns.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is a trusted image policy, as loaded from a file such as:
+//
+//	registries: [registry.example.com]
+//	allow: [python, "alpine:3.*"]
+//	deny: ["*:latest"]
+//
+// An image is allowed when it is on one of the registries or matches an
+// allow pattern, and is not matched by a deny pattern. Empty registries and
+// allow lists allow every image that is not denied.
+type Policy struct {
+	Registries []string `yaml:"registries"`
+	Allow      []string `yaml:"allow"`
+	Deny       []string `yaml:"deny"`
+
+	allow []pattern
+	deny  []pattern
+}
+
+// pattern is a compiled image glob.
+type pattern struct {
+	src string
+	re  *regexp.Regexp
+}
+
+// Verdict is the outcome of checking an image against the policy.
+type Verdict int
+
+const (
+	// Allowed images pass the policy.
+	Allowed Verdict = iota
+	// NotAllowed images are on no allowed registry and match no allow pattern.
+	NotAllowed
+	// Denied images match a deny pattern.
+	Denied
+)
+
+// Load reads and compiles a policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file %s: %w", path, err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses and compiles a policy. Unknown fields are rejected, so a typo
+// cannot silently turn a restriction off.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty policy")
+	} else if err != nil {
+		return nil, fmt.Errorf("parsing policy YAML: %w", err)
+	}
+
+	for i, reg := range p.Registries {
+		if reg = strings.TrimSpace(reg); reg == "" {
+			return nil, fmt.Errorf("empty registry")
+		}
+		if reg == "index.docker.io" {
+			reg = imageref.DefaultRegistry
+		}
+		p.Registries[i] = reg
+	}
+	var err error
+	if p.allow, err = compilePatterns(p.Allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = compilePatterns(p.Deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check returns the verdict for ref and, for denied images, the deny pattern
+// that matched. References that could not be parsed (e.g. an unresolved
+// variable) cannot be verified, so they are not allowed by a restrictive
+// policy.
+func (p *Policy) Check(ref imageref.Reference) (Verdict, string) {
+	if ref.Stage || ref.Scratch() {
+		return Allowed, ""
+	}
+
+	names := candidates(ref)
+	for _, pat := range p.deny {
+		if pat.matchAny(names) {
+			return Denied, pat.src
+		}
+	}
+
+	if len(p.Registries) == 0 && len(p.allow) == 0 {
+		return Allowed, ""
+	}
+	if ref.Repository != "" {
+		for _, reg := range p.Registries {
+			if ref.Registry == reg {
+				return Allowed, ""
+			}
+		}
+	}
+	for _, pat := range p.allow {
+		if pat.matchAny(names) {
+			return Allowed, ""
+		}
+	}
+	return NotAllowed, ""
+}
+
+// candidates returns the fully qualified names a pattern may match: with and
+// without tag and digest. Unparsed references only offer the raw text.
+func candidates(ref imageref.Reference) []string {
+	if ref.Repository == "" {
+		return []string{ref.Raw}
+	}
+	name := ref.Registry + "/" + ref.Repository
+	names := []string{name}
+	if ref.Tag != "" {
+		names = append(names, name+":"+ref.Tag)
+	}
+	if ref.Digest != "" {
+		names = append(names, name+"@"+ref.Digest)
+		if ref.Tag != "" {
+			names = append(names, name+":"+ref.Tag+"@"+ref.Digest)
+		}
+	}
+	return names
+}
+
+func compilePatterns(srcs []string) ([]pattern, error) {
+	patterns := make([]pattern, 0, len(srcs))
+	for _, src := range srcs {
+		src = strings.TrimSpace(src)
+		if src == "" {
+			return nil, fmt.Errorf("empty image pattern")
+		}
+		expr := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(qualify(src))) + "$"
+		patterns = append(patterns, pattern{src: src, re: regexp.MustCompile(expr)})
+	}
+	return patterns, nil
+}
+
+// qualify expands a pattern written the short way docker accepts images
+// ("python", "bitnami/*") to a fully qualified one. Patterns starting with a
+// wildcard are left alone.
+func qualify(src string) string {
+	if strings.HasPrefix(src, "*") {
+		return src
+	}
+	first, _, ok := strings.Cut(src, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return strings.Replace(src, "index.docker.io/", imageref.DefaultRegistry+"/", 1)
+	}
+	if !ok {
+		return imageref.DefaultRegistry + "/library/" + src
+	}
+	return imageref.DefaultRegistry + "/" + src
+}
+
+func (p pattern) matchAny(names []string) bool {
+	for _, name := range names {
+		if p.re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
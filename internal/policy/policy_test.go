@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+)
+
+func mustParseRef(t *testing.T, ref string) imageref.Reference {
+	t.Helper()
+	r, err := imageref.Parse(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCheck(t *testing.T) {
+	p, err := Parse([]byte(`registries:
+  - registry.example.com
+allow:
+  - python
+  - "alpine:3.*"
+  - bitnami/*
+  - ghcr.io/acme/*
+deny:
+  - "*:latest"
+  - registry.example.com/legacy/*
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref         string
+		want        Verdict
+		wantPattern string
+	}{
+		{"registry.example.com/team/app:1.0", Allowed, ""},
+		{"python:3.12-slim", Allowed, ""},
+		{"docker.io/library/python@sha256:" + strings.Repeat("ab", 32), Allowed, ""},
+		{"alpine:3.20", Allowed, ""},
+		{"alpine:edge", NotAllowed, ""},
+		{"bitnami/redis:7", Allowed, ""},
+		{"ghcr.io/acme/tools/cli:2", Allowed, ""},
+		{"ghcr.io/other/cli:2", NotAllowed, ""},
+		{"ubuntu:22.04", NotAllowed, ""},
+		{"python:latest", Denied, "*:latest"},
+		{"registry.example.com/legacy/app:1", Denied, "registry.example.com/legacy/*"},
+		{"scratch", Allowed, ""},
+	}
+	for _, tt := range tests {
+		got, pattern := p.Check(mustParseRef(t, tt.ref))
+		if got != tt.want || pattern != tt.wantPattern {
+			t.Errorf("Check(%s) = %v %q, want %v %q", tt.ref, got, pattern, tt.want, tt.wantPattern)
+		}
+	}
+
+	if got, _ := p.Check(imageref.StageRef("builder")); got != Allowed {
+		t.Errorf("stage references must be allowed, got %v", got)
+	}
+	if got, _ := p.Check(imageref.Reference{Raw: "${BASE}"}); got != NotAllowed {
+		t.Errorf("unparsed references must not be allowed, got %v", got)
+	}
+}
+
+func TestCheckDenyOnly(t *testing.T) {
+	p, err := Parse([]byte(`deny: [ubuntu]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := p.Check(mustParseRef(t, "debian:12")); got != Allowed {
+		t.Errorf("expected images to be allowed without allow lists, got %v", got)
+	}
+	if got, _ := p.Check(mustParseRef(t, "ubuntu:22.04")); got != Denied {
+		t.Errorf("expected ubuntu to be denied, got %v", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"registry: [x]", "field registry not found"},
+		{"registries: ['']", "empty registry"},
+		{"allow: ['  ']", "empty image pattern"},
+		{"deny: nope", "cannot unmarshal"},
+		{"", "empty policy"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.data, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Package registry resolves image tags to manifest digests with the OCI
+// distribution API, as served by Docker Hub, cloud registries and local
+// registries alike.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+)
+
+// DockerHubEndpoint serves the images of imageref.DefaultRegistry.
+const DockerHubEndpoint = "https://registry-1.docker.io"
+
+// manifestTypes are the manifest media types asked for, image indexes first so
+// multi-platform images resolve to the digest of the whole index.
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Client resolves tags against registries. The zero value uses
+// http.DefaultClient, anonymous access and the default endpoints.
+type Client struct {
+	// HTTP is the client requests are sent with, http.DefaultClient if nil.
+	HTTP *http.Client
+	// Endpoints maps a registry host, as written in image references (e.g.
+	// "docker.io" or "localhost:5000"), to the base URL of its API, e.g. a
+	// mirror or a local registry. Registries not listed are reached over
+	// HTTPS on their host, except localhost and loopback addresses, which are
+	// reached over plain HTTP like docker does.
+	Endpoints map[string]string
+	// Credentials maps a registry host, as in Endpoints, to the credentials
+	// sent to it, and to the token realm of its bearer challenges, when it
+	// asks for them. Other registries only get anonymous requests, so a
+	// Dockerfile naming an untrusted registry cannot obtain the credentials.
+	Credentials map[string]Credentials
+
+	mu     sync.Mutex
+	tokens map[string]string // "endpoint repository" -> bearer token
+}
+
+// Credentials are a username and password for a registry.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Endpoint returns the base URL of the API of registry host.
+func (c *Client) Endpoint(host string) string {
+	if ep, ok := c.Endpoints[host]; ok {
+		return strings.TrimSuffix(ep, "/")
+	}
+	if host == imageref.DefaultRegistry {
+		return DockerHubEndpoint
+	}
+	if isLoopback(host) {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+// Digest returns the digest of the manifest ref's tag points to, "latest"
+// when ref has no tag.
+func (c *Client) Digest(ctx context.Context, ref imageref.Reference) (string, error) {
+	if ref.Repository == "" {
+		return "", fmt.Errorf("cannot resolve image reference %s", ref.Raw)
+	}
+	tag := ref.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	endpoint := c.Endpoint(ref.Registry)
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", endpoint, ref.Repository, tag)
+
+	// HEAD is enough when the registry sends Docker-Content-Digest; without
+	// it the manifest is fetched and hashed.
+	header, _, err := c.manifest(ctx, http.MethodHead, manifestURL, endpoint, ref)
+	if err != nil {
+		return "", err
+	}
+	if digest := header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	header, body, err := c.manifest(ctx, http.MethodGet, manifestURL, endpoint, ref)
+	if err != nil {
+		return "", err
+	}
+	if digest := header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// manifest requests the manifest of ref at manifestURL and returns the
+// response headers and body.
+func (c *Client) manifest(ctx context.Context, method, manifestURL, endpoint string, ref imageref.Reference) (http.Header, []byte, error) {
+	resp, err := c.do(ctx, method, manifestURL, endpoint, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading manifest of %s: %w", ref.Raw, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Header, body, nil
+	case http.StatusNotFound:
+		return nil, nil, fmt.Errorf("%s: manifest unknown", ref.Raw)
+	default:
+		return nil, nil, fmt.Errorf("%s: registry returned %s", ref.Raw, resp.Status)
+	}
+}
+
+// do sends a request for the repository of ref, authenticating when the
+// registry asks to: a bearer token is fetched from the realm of the challenge
+// (and cached per repository), basic challenges get the credentials of the
+// registry directly.
+func (c *Client) do(ctx context.Context, method, rawURL, endpoint string, ref imageref.Reference) (*http.Response, error) {
+	repository := ref.Repository
+	creds, hasCreds := c.Credentials[ref.Registry]
+	key := endpoint + " " + repository
+	c.mu.Lock()
+	token := c.tokens[key]
+	c.mu.Unlock()
+
+	resp, err := c.send(ctx, method, rawURL, func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	})
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch scheme {
+	case "bearer":
+		if token, err = c.fetchToken(ctx, params, repository, creds); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.tokens == nil {
+			c.tokens = make(map[string]string)
+		}
+		c.tokens[key] = token
+		c.mu.Unlock()
+		return c.send(ctx, method, rawURL, func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		})
+	case "basic":
+		if !hasCreds || creds.Username == "" {
+			return nil, fmt.Errorf("%s: registry requires credentials", endpoint)
+		}
+		return c.send(ctx, method, rawURL, func(req *http.Request) {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		})
+	}
+	return nil, fmt.Errorf("%s: unsupported authentication challenge %q", endpoint, scheme)
+}
+
+func (c *Client) send(ctx context.Context, method, rawURL string, auth func(*http.Request)) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	auth(req)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting registry: %w", err)
+	}
+	return resp, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
+
+// fetchToken gets a pull token for repository from the realm of a bearer
+// challenge, with creds if they have a username.
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, repository string, creds Credentials) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching registry token: %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("fetching registry token: empty token")
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`
+// into its lower-cased scheme and parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var pair string
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				end = len(value) - 1
+			}
+			pair, rest = value[1:end+1], value[min(end+2, len(value)):]
+		} else {
+			pair, rest, _ = strings.Cut(value, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = pair
+	}
+	return strings.ToLower(scheme), params
+}
+
+// isLoopback reports whether host, with an optional port, is localhost or a
+// loopback address.
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
+)
+
+const testDigest = "sha256:65cb2034c64b4519f1481c552a30ae3fe19f47f3610513b0387dc2e1570080fa"
+
+// newRegistry serves team/app:1.0 behind bearer token auth that requires the
+// user "ci" with password "secret".
+func newRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "ci" || pass != "secret" || r.URL.Query().Get("scope") != "repository:team/app:pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"token":"t0k3n"}`))
+	})
+	mux.HandleFunc("/v2/team/app/manifests/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+			t.Errorf("missing index media type in Accept: %s", r.Header.Get("Accept"))
+		}
+		if !strings.HasSuffix(r.URL.Path, "/1.0") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func mustParse(t *testing.T, ref string) imageref.Reference {
+	t.Helper()
+	r, err := imageref.Parse(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDigestBearer(t *testing.T) {
+	srv := newRegistry(t)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	c := &Client{Credentials: map[string]Credentials{host: {Username: "ci", Password: "secret"}}}
+
+	got, err := c.Digest(context.Background(), mustParse(t, host+"/team/app:1.0"))
+	if err != nil || got != testDigest {
+		t.Errorf("Digest = %q, %v, want %q", got, err, testDigest)
+	}
+
+	if _, err := c.Digest(context.Background(), mustParse(t, host+"/team/app:2.0")); err == nil || !strings.Contains(err.Error(), "manifest unknown") {
+		t.Errorf("expected an unknown manifest error, got %v", err)
+	}
+
+	anonymous := &Client{}
+	if _, err := anonymous.Digest(context.Background(), mustParse(t, host+"/team/app:1.0")); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
+
+func TestDigestEndpointAndHash(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+	sum := sha256.Sum256(manifest)
+	want := "sha256:" + hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "ci" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mirror"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/library/python/manifests/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// No Docker-Content-Digest: the client hashes the manifest.
+		if r.Method == http.MethodGet {
+			w.Write(manifest)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		Endpoints:   map[string]string{"docker.io": srv.URL + "/"},
+		Credentials: map[string]Credentials{"docker.io": {Username: "ci", Password: "secret"}},
+	}
+	got, err := c.Digest(context.Background(), mustParse(t, "python"))
+	if err != nil || got != want {
+		t.Errorf("Digest = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestCredentialsOnlyForTheirRegistry(t *testing.T) {
+	trusted := newRegistry(t)
+
+	// The other registry asks for credentials with both challenges, the
+	// bearer one pointing at a realm of its own.
+	var authorized []string
+	var other *httptest.Server
+	other = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			authorized = append(authorized, r.URL.Path+": "+auth)
+		}
+		switch {
+		case r.URL.Path == "/token":
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		case strings.HasPrefix(r.URL.Path, "/v2/basic/"):
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+other.URL+`/token",service="other"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer other.Close()
+
+	trustedHost := strings.TrimPrefix(trusted.URL, "http://")
+	otherHost := strings.TrimPrefix(other.URL, "http://")
+	c := &Client{Credentials: map[string]Credentials{trustedHost: {Username: "ci", Password: "secret"}}}
+
+	for _, ref := range []string{otherHost + "/basic/app:1.0", otherHost + "/bearer/app:1.0"} {
+		if _, err := c.Digest(context.Background(), mustParse(t, ref)); err == nil {
+			t.Errorf("expected %s to fail without credentials", ref)
+		}
+	}
+	if len(authorized) != 0 {
+		t.Errorf("credentials sent to an unconfigured registry: %q", authorized)
+	}
+
+	if got, err := c.Digest(context.Background(), mustParse(t, trustedHost+"/team/app:1.0")); err != nil || got != testDigest {
+		t.Errorf("Digest = %q, %v, want %q", got, err, testDigest)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	c := &Client{Endpoints: map[string]string{"mirror.example.com": "http://10.0.0.1:5000"}}
+	tests := map[string]string{
+		"docker.io":          DockerHubEndpoint,
+		"ghcr.io":            "https://ghcr.io",
+		"localhost:5000":     "http://localhost:5000",
+		"127.0.0.1:5000":     "http://127.0.0.1:5000",
+		"[::1]:5000":         "http://[::1]:5000",
+		"mirror.example.com": "http://10.0.0.1:5000",
+	}
+	for host, want := range tests {
+		if got := c.Endpoint(host); got != want {
+			t.Errorf("Endpoint(%s) = %s, want %s", host, got, want)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/python:pull"`)
+	if scheme != "bearer" || params["realm"] != "https://auth.docker.io/token" || params["service"] != "registry.docker.io" || params["scope"] != "repository:library/python:pull" {
+		t.Errorf("parseChallenge = %s %v", scheme, params)
+	}
+	if scheme, params := parseChallenge(`Basic realm=registry`); scheme != "basic" || params["realm"] != "registry" {
+		t.Errorf("parseChallenge = %s %v", scheme, params)
+	}
+}
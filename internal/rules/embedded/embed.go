@@ -16,3 +16,9 @@ var PackagesYAML []byte
 
 //go:embed configuration.yaml
 var ConfigurationYAML []byte
+
+//go:embed eol.yaml
+var EOLYAML []byte
+
+//go:embed placeholders.yaml
+var PlaceholdersYAML []byte
@@ -7,10 +7,28 @@ import (
 	"os"
 	"strings"
 
+	"github.com/cr0hn/dockerfile-sec/internal/imageref"
 	"github.com/cr0hn/dockerfile-sec/internal/rules/embedded"
 	"gopkg.in/yaml.v3"
 )
 
+// Match modes for Rule.Match.
+const (
+	// MatchPresent fires for every occurrence of the regex (the default).
+	MatchPresent = "present"
+	// MatchAbsent fires once when the regex matches no instruction at all.
+	MatchAbsent = "absent"
+)
+
+// Stage scopes for Rule.Stages.
+const (
+	// StagesAll evaluates the rule in every build stage (the default).
+	StagesAll = "all"
+	// StagesFinal evaluates the rule only in the target stage and the stages
+	// it is built FROM, i.e. the layers that ship in the image.
+	StagesFinal = "final"
+)
+
 // Rule represents a single security rule loaded from YAML.
 type Rule struct {
 	ID          string `yaml:"id" json:"id"`
@@ -18,14 +36,228 @@ type Rule struct {
 	Regex       string `yaml:"regex" json:"-"`
 	Reference   string `yaml:"reference" json:"reference"`
 	Severity    string `yaml:"severity" json:"severity"`
+	// Match is MatchPresent (default when empty) or MatchAbsent.
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+	// Instruction restricts the rule to the listed instructions (e.g. RUN).
+	// Scoped rules are matched against the text after the keyword, flags
+	// included; unscoped rules are matched against the whole instruction.
+	Instruction StringList `yaml:"instruction,omitempty" json:"instruction,omitempty"`
+	// Stages is StagesAll (default when empty) or StagesFinal.
+	Stages string `yaml:"stages,omitempty" json:"stages,omitempty"`
+	// Expand evaluates the rule against instructions with ARG and ENV
+	// references substituted (e.g. "FROM ${BASE}" becomes "FROM python:latest").
+	Expand bool `yaml:"expand,omitempty" json:"expand,omitempty"`
+	// Command matches shell commands structurally instead of using Regex.
+	// Command rules apply to RUN unless Instruction says otherwise.
+	Command *CommandMatch `yaml:"command,omitempty" json:"command,omitempty"`
+	// Timeout is a Go duration (e.g. "500ms") bounding the time the rule may
+	// spend on one Dockerfile. Empty means the scan-wide default.
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// When is an expression over the facts of an instruction (see Facts),
+	// e.g. `image.tag == "latest" && !image.digest`. The rule only sees the
+	// instructions it holds for; without Regex or Command it reports them.
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+	// Fix is the mechanical remediation -fix applies to the rule's matches.
+	Fix *Fix `yaml:"fix,omitempty" json:"fix,omitempty"`
+	// Remediation tells how to fix an issue of the rule by hand.
+	Remediation string `yaml:"remediation,omitempty" json:"remediation,omitempty"`
+	// ExampleFix shows a Dockerfile snippet before and after the remediation.
+	ExampleFix *ExampleFix `yaml:"example_fix,omitempty" json:"example_fix,omitempty"`
+	// Secret marks rules whose matches are credentials, which outputs redact.
+	Secret bool `yaml:"secret,omitempty" json:"secret,omitempty"`
+
+	// source and line locate the id of rules loaded from YAML, for
+	// ValidationErrors about them.
+	source string
+	line   int
+}
+
+// ExampleFix is a Dockerfile snippet with an issue and the same snippet fixed.
+type ExampleFix struct {
+	Before string `yaml:"before" json:"before"`
+	After  string `yaml:"after" json:"after"`
+}
+
+// Fix declares how to rewrite a match of a rule. A fix only rewrites the text
+// it touches, so the formatting and comments of the Dockerfile are kept.
+// Matches in instructions changed by variable expansion or holding heredocs
+// are not fixed, and only Instruction applies to the exec (JSON array) form.
+type Fix struct {
+	// Instruction replaces the instruction keyword, e.g. ADD with COPY.
+	Instruction string `yaml:"instruction,omitempty" json:"instruction,omitempty"`
+	// Replace replaces the match of a regex rule; $1 or ${name} insert the
+	// text of a regex group.
+	Replace *string `yaml:"replace,omitempty" json:"replace,omitempty"`
+	// Append is inserted right after the match, or after the matched shell
+	// command of a command rule.
+	Append string `yaml:"append,omitempty" json:"append,omitempty"`
+	// Unless is a regex; the fix is not applied to instructions whose text
+	// after the keyword it matches, e.g. ADD of a URL or an archive.
+	Unless string `yaml:"unless,omitempty" json:"unless,omitempty"`
+}
+
+// Facts are the names a When expression can refer to:
+//
+//	instruction  upper-cased keyword, e.g. "FROM"
+//	args         arguments after the keyword and flags
+//	flags        object of flag values, e.g. flags.platform
+//	stage        object with index, name and shipped; null before the first FROM
+//	image        base image of FROM, or the image of COPY --from: ref,
+//	             registry, namespace, name, repository, tag, digest, scratch
+//	             and stage (true for a reference to an earlier build stage);
+//	             null otherwise. See imageref.Reference
+//	user         user the instruction runs as, from the last USER in effect
+//	ports        port numbers listed by EXPOSE, empty for other instructions
+var Facts = []string{"instruction", "args", "flags", "stage", "image", "user", "ports"}
+
+// CommandMatch selects shell commands by name and arguments. Arguments are
+// matched against regexes that must match a whole (unquoted) argument.
+type CommandMatch struct {
+	// Name lists the command names to match, e.g. [pip, pip3]. Paths such as
+	// /usr/bin/pip are matched by their base name.
+	Name StringList `yaml:"name" json:"name"`
+	// Args must each match at least one argument of the command.
+	Args StringList `yaml:"args,omitempty" json:"args,omitempty"`
+	// Without reports the command only when no argument matches any of them.
+	Without StringList `yaml:"without,omitempty" json:"without,omitempty"`
+	// Unless suppresses the match when a later command of the same
+	// instruction matches it, e.g. a cleanup step after an install.
+	Unless *CommandMatch `yaml:"unless,omitempty" json:"unless,omitempty"`
+}
+
+// FinalOnly reports whether the rule only applies to the stages that ship in
+// the target image.
+func (r Rule) FinalOnly() bool {
+	return strings.EqualFold(r.Stages, StagesFinal)
+}
+
+// AppliesTo reports whether the rule is evaluated for instruction cmd.
+func (r Rule) AppliesTo(cmd string) bool {
+	if len(r.Instruction) == 0 {
+		return r.Command == nil || cmd == "RUN"
+	}
+	for _, in := range r.Instruction {
+		if strings.EqualFold(in, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scoped reports whether the rule is restricted to specific instructions.
+func (r Rule) Scoped() bool {
+	return len(r.Instruction) > 0
+}
+
+// StringList is a YAML field that accepts either a single string or a list.
+type StringList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = StringList{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Absent reports whether the rule fires when its regex is NOT found.
+func (r Rule) Absent() bool {
+	return strings.EqualFold(r.Match, MatchAbsent)
 }
 
 // Issue represents a matched rule (without the regex field).
 type Issue struct {
-	ID          string `json:"id"`
-	Description string `json:"description"`
-	Reference   string `json:"reference"`
-	Severity    string `json:"severity"`
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Reference   string    `json:"reference"`
+	Severity    string    `json:"severity"`
+	Location    *Location `json:"location,omitempty"`
+	Match       string    `json:"match,omitempty"`
+	Stage       *Stage    `json:"stage,omitempty"`
+	// Secret is set when Match holds a credential, see Rule.Secret.
+	Secret bool `json:"secret,omitempty"`
+	// Remediation and ExampleFix are copied from the rule, see Rule.
+	Remediation string      `json:"remediation,omitempty"`
+	ExampleFix  *ExampleFix `json:"example_fix,omitempty"`
+	// Image is the image reference of the FROM or COPY --from instruction
+	// the issue was found in.
+	Image *imageref.Reference `json:"image,omitempty"`
+	// Kind is empty for findings and KindTimeout for rules that could not be
+	// evaluated in time; Error then says why.
+	Kind  string `json:"kind,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Fix holds the edits that fix the issue, see Rule.Fix.
+	Fix []Edit `json:"fix,omitempty"`
+	// Suppressed is set when an inline comment in the Dockerfile suppresses
+	// the issue. Suppressed issues are kept for auditing but do not fail a scan.
+	Suppressed *Suppression `json:"suppressed,omitempty"`
+}
+
+// KindTimeout marks an issue reporting a rule that ran out of time, so the
+// Dockerfile was not fully checked by it.
+const KindTimeout = "timeout"
+
+// Suppression kinds for Suppression.Kind.
+const (
+	// SuppressInline is a "# dockerfile-sec:ignore" comment above an instruction.
+	SuppressInline = "inline"
+	// SuppressFile is a "# dockerfile-sec:ignore-file" comment.
+	SuppressFile = "file"
+)
+
+// Suppression records which comment suppressed an issue and why.
+type Suppression struct {
+	Kind   string `json:"kind"`
+	Reason string `json:"reason,omitempty"`
+	// Line is the line of the suppressing comment.
+	Line int `json:"line"`
+}
+
+// Unsuppressed returns the issues that no inline comment suppressed.
+func Unsuppressed(issues []Issue) []Issue {
+	var active []Issue
+	for _, issue := range issues {
+		if issue.Suppressed == nil {
+			active = append(active, issue)
+		}
+	}
+	return active
+}
+
+// Stage identifies the build stage an issue was found in.
+type Stage struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	// Shipped is true when the stage's layers end up in the target image, and
+	// false for builder stages that are discarded.
+	Shipped bool `json:"shipped"`
+}
+
+// Edit replaces the text at Location with Text. Insertions have an empty
+// span, with the end equal to the start.
+type Edit struct {
+	Location Location `json:"location"`
+	Text     string   `json:"text"`
+}
+
+// Location is the span of the Dockerfile a rule matched. Lines and columns are
+// 1-based; EndColumn points one past the last matched character.
+type Location struct {
+	StartLine   int `json:"start_line"`
+	StartColumn int `json:"start_column"`
+	EndLine     int `json:"end_line"`
+	EndColumn   int `json:"end_column"`
+}
+
+// String formats the start of the location as "line:column".
+func (l Location) String() string {
+	return fmt.Sprintf("%d:%d", l.StartLine, l.StartColumn)
 }
 
 // IssueFromRule creates an Issue from a Rule, omitting the regex.
@@ -35,12 +267,18 @@ func IssueFromRule(r Rule) Issue {
 		Description: r.Description,
 		Reference:   r.Reference,
 		Severity:    r.Severity,
+		Remediation: r.Remediation,
+		ExampleFix:  r.ExampleFix,
+		Secret:      r.Secret,
 	}
 }
 
-// LoadInternal loads built-in rules based on the selection flag.
+// Categories lists the built-in rule categories, in load order.
+var Categories = []string{"core", "credentials", "security", "packages", "configuration"}
+
+// SelectCategories resolves a -R selection into built-in categories.
 // Valid selections: "all" (default), "core", "credentials", "security", "packages", "configuration", "none", or comma-separated combinations.
-func LoadInternal(selection string) ([]Rule, error) {
+func SelectCategories(selection string) ([]string, error) {
 	selection = strings.ToLower(selection)
 
 	// Handle special cases
@@ -49,70 +287,69 @@ func LoadInternal(selection string) ([]Rule, error) {
 	}
 
 	if selection == "all" || selection == "" {
-		return loadAllCategories()
-	}
-
-	// Handle comma-separated categories
-	if strings.Contains(selection, ",") {
-		categories := strings.Split(selection, ",")
-		var allRules []Rule
-		for _, cat := range categories {
-			cat = strings.TrimSpace(cat)
-			rules, err := loadCategory(cat)
-			if err != nil {
-				return nil, err
-			}
-			allRules = append(allRules, rules...)
+		return Categories, nil
+	}
+
+	var selected []string
+	for _, cat := range strings.Split(selection, ",") {
+		cat = strings.TrimSpace(cat)
+		if !knownCategory(cat) {
+			return nil, fmt.Errorf("unknown rule category: %s", cat)
+		}
+		selected = append(selected, cat)
+	}
+	return selected, nil
+}
+
+func knownCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
 		}
-		return allRules, nil
+	}
+	return false
+}
+
+// LoadInternal loads built-in rules based on the selection flag, as resolved
+// by SelectCategories.
+func LoadInternal(selection string) ([]Rule, error) {
+	categories, err := SelectCategories(selection)
+	if err != nil {
+		return nil, err
 	}
 
-	// Single category
-	return loadCategory(selection)
+	var allRules []Rule
+	for _, cat := range categories {
+		rules, err := loadCategory(cat)
+		if err != nil {
+			return nil, err
+		}
+		allRules = append(allRules, rules...)
+	}
+	return allRules, nil
 }
 
 // loadCategory loads a single category of rules.
 func loadCategory(category string) ([]Rule, error) {
 	switch category {
 	case "core":
-		return parseYAML(embedded.CoreYAML)
+		return parseYAML(embedded.CoreYAML, "core.yaml")
 	case "credentials":
-		return parseYAML(embedded.CredentialsYAML)
+		return parseYAML(embedded.CredentialsYAML, "credentials.yaml")
 	case "security":
-		return parseYAML(embedded.SecurityYAML)
+		return parseYAML(embedded.SecurityYAML, "security.yaml")
 	case "packages":
-		return parseYAML(embedded.PackagesYAML)
+		return parseYAML(embedded.PackagesYAML, "packages.yaml")
 	case "configuration":
-		return parseYAML(embedded.ConfigurationYAML)
+		return parseYAML(embedded.ConfigurationYAML, "configuration.yaml")
 	default:
 		return nil, fmt.Errorf("unknown rule category: %s", category)
 	}
 }
 
-// loadAllCategories loads all built-in rule categories.
-func loadAllCategories() ([]Rule, error) {
-	var allRules []Rule
-
-	categories := [][]byte{
-		embedded.CoreYAML,
-		embedded.CredentialsYAML,
-		embedded.SecurityYAML,
-		embedded.PackagesYAML,
-		embedded.ConfigurationYAML,
-	}
-
-	for _, data := range categories {
-		rules, err := parseYAML(data)
-		if err != nil {
-			return nil, err
-		}
-		allRules = append(allRules, rules...)
-	}
-
-	return allRules, nil
-}
-
-// LoadExternal loads rules from a file path or URL.
+// LoadExternal loads rules from a file path or URL. Every rule is validated;
+// invalid rules are left out and described by a ValidationErrors error
+// returned together with the valid rules.
 func LoadExternal(source string) ([]Rule, error) {
 	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
 		return LoadFromURL(source)
@@ -126,7 +363,7 @@ func LoadFromFile(path string) ([]Rule, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading rules file %s: %w", path, err)
 	}
-	return parseYAML(data)
+	return parseYAML(data, path)
 }
 
 // LoadFromURL loads rules from a remote YAML URL.
@@ -145,13 +382,5 @@ func LoadFromURL(url string) ([]Rule, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading rules from %s: %w", url, err)
 	}
-	return parseYAML(data)
-}
-
-func parseYAML(data []byte) ([]Rule, error) {
-	var rules []Rule
-	if err := yaml.Unmarshal(data, &rules); err != nil {
-		return nil, fmt.Errorf("parsing rules YAML: %w", err)
-	}
-	return rules, nil
+	return parseYAML(data, url)
 }
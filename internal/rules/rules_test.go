@@ -1,10 +1,12 @@
 package rules
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -13,8 +15,13 @@ func TestLoadInternalAll(t *testing.T) {
 	if err != nil {
 		t.Fatalf("LoadInternal(all): %v", err)
 	}
-	if len(rules) != 35 {
-		t.Errorf("expected 35 rules, got %d", len(rules))
+	if len(rules) != 38 {
+		t.Errorf("expected 38 rules, got %d", len(rules))
+	}
+	for _, r := range rules {
+		if r.Remediation == "" || r.ExampleFix == nil {
+			t.Errorf("rule %s has no remediation or example fix", r.ID)
+		}
 	}
 }
 
@@ -23,8 +30,8 @@ func TestLoadInternalCore(t *testing.T) {
 	if err != nil {
 		t.Fatalf("LoadInternal(core): %v", err)
 	}
-	if len(rules) != 10 {
-		t.Errorf("expected 10 core rules, got %d", len(rules))
+	if len(rules) != 11 {
+		t.Errorf("expected 11 core rules, got %d", len(rules))
 	}
 	for _, r := range rules {
 		if r.ID == "" || r.Description == "" || r.Regex == "" {
@@ -58,8 +65,8 @@ func TestLoadInternalDefault(t *testing.T) {
 	if err != nil {
 		t.Fatalf("LoadInternal(''): %v", err)
 	}
-	if len(rules) != 35 {
-		t.Errorf("expected 35 rules for default, got %d", len(rules))
+	if len(rules) != 38 {
+		t.Errorf("expected 38 rules for default, got %d", len(rules))
 	}
 }
 
@@ -90,24 +97,24 @@ func TestLoadInternalMultiple(t *testing.T) {
 	if err != nil {
 		t.Fatalf("LoadInternal(core,security): %v", err)
 	}
-	if len(rules) != 17 {
-		t.Errorf("expected 17 rules (10 core + 7 security), got %d", len(rules))
+	if len(rules) != 18 {
+		t.Errorf("expected 18 rules (11 core + 7 security), got %d", len(rules))
 	}
 
 	rules, err = LoadInternal("credentials,packages")
 	if err != nil {
 		t.Fatalf("LoadInternal(credentials,packages): %v", err)
 	}
-	if len(rules) != 15 {
-		t.Errorf("expected 15 rules (11 credentials + 4 packages), got %d", len(rules))
+	if len(rules) != 16 {
+		t.Errorf("expected 16 rules (11 credentials + 5 packages), got %d", len(rules))
 	}
 
 	rules, err = LoadInternal("security,packages,configuration")
 	if err != nil {
 		t.Fatalf("LoadInternal(security,packages,configuration): %v", err)
 	}
-	if len(rules) != 14 {
-		t.Errorf("expected 14 rules (7+4+3), got %d", len(rules))
+	if len(rules) != 16 {
+		t.Errorf("expected 16 rules (7+5+4), got %d", len(rules))
 	}
 }
 
@@ -173,8 +180,8 @@ func TestRuleFieldsNotEmpty(t *testing.T) {
 		if r.Description == "" {
 			t.Errorf("rule %s has empty description", r.ID)
 		}
-		if r.Regex == "" {
-			t.Errorf("rule %s has empty regex", r.ID)
+		if r.Regex == "" && r.Command == nil {
+			t.Errorf("rule %s has neither regex nor command", r.ID)
 		}
 		if r.Reference == "" {
 			t.Errorf("rule %s has empty reference", r.ID)
@@ -196,6 +203,78 @@ func TestIssueFromRule(t *testing.T) {
 	}
 }
 
+func TestRuleAbsent(t *testing.T) {
+	tests := []struct {
+		match string
+		want  bool
+	}{
+		{"", false},
+		{MatchPresent, false},
+		{MatchAbsent, true},
+		{"Absent", true},
+	}
+	for _, tt := range tests {
+		if got := (Rule{Match: tt.match}).Absent(); got != tt.want {
+			t.Errorf("Rule{Match: %q}.Absent() = %v, want %v", tt.match, got, tt.want)
+		}
+	}
+
+	core, err := LoadInternal("core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range core {
+		if r.ID == "core-001" && !r.Absent() {
+			t.Error("core-001 (missing USER) should be an absence rule")
+		}
+	}
+}
+
+func TestRuleInstructionScope(t *testing.T) {
+	data := []byte(`- id: one
+  description: Single instruction
+  instruction: run
+  regex: '(x)'
+  reference: https://example.com
+  severity: Low
+- id: many
+  description: Instruction list
+  instruction: [ENV, ARG]
+  regex: '(x)'
+  reference: https://example.com
+  severity: Low
+- id: all
+  description: Unscoped
+  regex: '(x)'
+  reference: https://example.com
+  severity: Low
+`)
+	rules, err := parseYAML(data, "test.yaml")
+	if err != nil {
+		t.Fatalf("parseYAML: %v", err)
+	}
+
+	tests := []struct {
+		rule int
+		cmd  string
+		want bool
+	}{
+		{0, "RUN", true},
+		{0, "ENV", false},
+		{1, "ARG", true},
+		{1, "RUN", false},
+		{2, "LABEL", true},
+	}
+	for _, tt := range tests {
+		if got := rules[tt.rule].AppliesTo(tt.cmd); got != tt.want {
+			t.Errorf("%s.AppliesTo(%s) = %v, want %v", rules[tt.rule].ID, tt.cmd, got, tt.want)
+		}
+	}
+	if rules[2].Scoped() {
+		t.Error("rule without instruction should not be scoped")
+	}
+}
+
 func TestLoadFromURL(t *testing.T) {
 	yamlContent := `- id: http-001
   description: Rule loaded from HTTP
@@ -284,3 +363,201 @@ func TestLoadExternalWithURL(t *testing.T) {
 		t.Errorf("expected ext-001, got %s", rules[0].ID)
 	}
 }
+
+func TestRuleCommand(t *testing.T) {
+	data := []byte(`- id: cmd
+  description: Command rule
+  command:
+    name: [pip, pip3]
+    args: install
+    without: --no-cache-dir
+    unless:
+      name: rm
+      args: [-rf, /root/.cache]
+  reference: https://example.com
+  severity: Low
+`)
+	rules, err := parseYAML(data, "test.yaml")
+	if err != nil {
+		t.Fatalf("parseYAML: %v", err)
+	}
+
+	cmd := rules[0].Command
+	if cmd == nil || len(cmd.Name) != 2 || cmd.Args[0] != "install" || cmd.Without[0] != "--no-cache-dir" {
+		t.Fatalf("unexpected command: %+v", cmd)
+	}
+	if cmd.Unless == nil || cmd.Unless.Name[0] != "rm" || len(cmd.Unless.Args) != 2 {
+		t.Errorf("unexpected unless: %+v", cmd.Unless)
+	}
+	if !rules[0].AppliesTo("RUN") || rules[0].AppliesTo("ENV") {
+		t.Error("command rules without instruction should apply to RUN only")
+	}
+}
+
+func TestValidation(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "invalid-rules.yaml")
+	rules, err := LoadExternal(path)
+
+	var problems ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	if len(rules) != 1 || rules[0].ID != "custom-001" || rules[0].Regex != `(EXPOSE[\s]+[\d]+)` {
+		t.Errorf("expected only the first custom-001 to load, got %+v", rules)
+	}
+
+	want := []struct {
+		line int
+		id   string
+		msg  string
+	}{
+		{6, "", "missing id"},
+		{10, "custom-001", "duplicate id, first defined on line 1"},
+		{17, "custom-003", "empty regex"},
+		{24, "custom-004", `unknown severity "Severe"`},
+		{27, "custom-005", "invalid regex"},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %d:\n%v", len(want), len(problems), problems)
+	}
+	for i, w := range want {
+		p := problems[i]
+		if p.Source != path || p.Line != w.line || p.RuleID != w.id || !strings.Contains(p.Msg, w.msg) {
+			t.Errorf("problem %d = %+v, want line %d, id %q, msg %q", i, p, w.line, w.id, w.msg)
+		}
+	}
+	if msg := problems[3].Error(); !strings.HasPrefix(msg, path+":24: rule custom-004: unknown severity") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
+
+func TestUniqueIDs(t *testing.T) {
+	builtin, err := LoadInternal("core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken := append(builtin, Rule{ID: "ent-001"})
+
+	path := filepath.Join("..", "..", "testdata", "custom-rules.yaml")
+	custom, err := LoadExternal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reused, err := parseYAML([]byte(`- id: core-004
+  description: ADD instead of COPY
+  regex: '^ADD'
+  reference: https://example.com
+  severity: Low
+- id: ent-001
+  description: Hex string
+  regex: '[0-9a-f]{32}'
+  reference: https://example.com
+  severity: Low
+`), "reused.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := append(append(append([]Rule(nil), custom...), custom[0]), reused...)
+	unique, err := UniqueIDs(taken, list)
+	if len(unique) != len(custom) {
+		t.Errorf("expected the %d rules of %s, got %d", len(custom), path, len(unique))
+	}
+
+	var problems ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	want := []string{
+		path + ":1: rule custom-001: duplicate id, first defined in " + path + ":1",
+		"reused.yaml:1: rule core-004: duplicate id, first defined in core.yaml:",
+		"reused.yaml:6: rule ent-001: duplicate id, used by a built-in check",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %d:\n%v", len(want), len(problems), problems)
+	}
+	for i, w := range want {
+		if msg := problems[i].Error(); !strings.HasPrefix(msg, w) {
+			t.Errorf("problem %d = %q, want %q", i, msg, w)
+		}
+	}
+}
+
+func TestValidationRuleFields(t *testing.T) {
+	data := []byte(`- id: a
+  description: Bad match and stages
+  regex: '(x)'
+  match: missing
+  stages: first
+  reference: https://example.com
+  severity: Low
+- id: b
+  description: Regex and command
+  regex: '(x)'
+  command:
+    name: pip
+  reference: https://example.com
+  severity: low
+- id: c
+  description: Bad type
+  instruction: {run: true}
+- id: d
+  description: Bad timeout
+  regex: '(x)'
+  reference: https://example.com
+  severity: Low
+  timeout: -1s
+- id: e
+  description: Unknown fact
+  when: 'image.tag == "latest" && tag'
+  reference: https://example.com
+  severity: Low
+- id: f
+  description: When only
+  when: 'instruction == "FROM" && !image.digest'
+  reference: https://example.com
+  severity: Low
+- id: g
+  description: Replace in a command rule
+  command:
+    name: pip
+  fix:
+    replace: pip3
+  reference: https://example.com
+  severity: Low
+- id: h
+  description: Example fix without after
+  regex: '(x)'
+  example_fix:
+    before: x
+  reference: https://example.com
+  severity: Low
+`)
+	rules, err := parseYAML(data, "test.yaml")
+	var problems ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	if len(rules) != 1 || rules[0].ID != "f" {
+		t.Errorf("expected only the when-only rule f to be valid, got %+v", rules)
+	}
+	msgs := problems.Error()
+	for _, want := range []string{
+		`test.yaml:4: rule a: unknown match "missing"`,
+		`test.yaml:5: rule a: unknown stages "first"`,
+		"test.yaml:10: rule b: regex and command are mutually exclusive",
+		"test.yaml:15: rule: ",
+		`test.yaml:23: rule d: invalid timeout "-1s"`,
+		`test.yaml:26: rule e: invalid when: unknown fact "tag"`,
+		"test.yaml:39: rule g: invalid fix: replace needs a regex rule",
+		"test.yaml:46: rule h: example_fix needs a before and an after snippet",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Errorf("missing %q in:\n%s", want, msgs)
+		}
+	}
+
+	if _, err := parseYAML([]byte("id: not-a-list\n"), "test.yaml"); err == nil || errors.As(err, &problems) {
+		t.Errorf("expected a parse error for a non-list document, got %v", err)
+	}
+}
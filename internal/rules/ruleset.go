@@ -0,0 +1,242 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cr0hn/dockerfile-sec/internal/expr"
+	"github.com/cr0hn/dockerfile-sec/internal/shell"
+	"github.com/dlclark/regexp2"
+)
+
+// DefaultTimeout bounds the time a rule may spend on one Dockerfile when
+// neither the rule nor the caller sets a timeout.
+const DefaultTimeout = 5 * time.Second
+
+// CompiledRule is a Rule with its regex or command matcher compiled.
+type CompiledRule struct {
+	Rule
+	// Pattern is the compiled Regex, nil for command rules.
+	Pattern *regexp2.Regexp
+	// Matcher is the compiled Command, nil for regex rules.
+	Matcher *CommandMatcher
+	// Condition is the compiled When, nil if not set.
+	Condition *expr.Expr
+	// FixUnless is the compiled Fix.Unless, nil if not set.
+	FixUnless *regexp2.Regexp
+	// Timeout is the rule's own timeout, or the default it was compiled with.
+	Timeout time.Duration
+}
+
+// RuleSet is a set of compiled rules. It is immutable once built and safe for
+// concurrent use, so it can be compiled once and shared by every scan.
+type RuleSet struct {
+	rules []CompiledRule
+}
+
+// Compile compiles ruleList into a RuleSet, keeping the order of the rules.
+// Rules without a timeout of their own get timeout, or DefaultTimeout when it
+// is zero or less. Rules that fail to compile are left out of the set and
+// reported together in the returned error; the set holds the remaining rules
+// even then.
+func Compile(ruleList []Rule, timeout time.Duration) (*RuleSet, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	set := &RuleSet{rules: make([]CompiledRule, 0, len(ruleList))}
+	var errs []error
+
+	for _, rule := range ruleList {
+		cr := CompiledRule{Rule: rule, Timeout: timeout}
+		var err error
+		if rule.Timeout != "" {
+			if cr.Timeout, err = ParseTimeout(rule.Timeout); err != nil {
+				errs = append(errs, fmt.Errorf("invalid timeout for rule %s: %w", rule.ID, err))
+				continue
+			}
+		}
+		if rule.When != "" {
+			if cr.Condition, err = CompileWhen(rule.When); err != nil {
+				errs = append(errs, fmt.Errorf("invalid when for rule %s: %w", rule.ID, err))
+				continue
+			}
+		}
+		if rule.Command != nil {
+			if cr.Matcher, err = CompileCommand(rule.Command, cr.Timeout); err != nil {
+				errs = append(errs, fmt.Errorf("invalid command for rule %s: %w", rule.ID, err))
+				continue
+			}
+		} else if rule.Regex != "" || rule.When == "" {
+			if cr.Pattern, err = regexp2.Compile(rule.Regex, regexp2.Multiline); err != nil {
+				errs = append(errs, fmt.Errorf("invalid regex for rule %s: %w", rule.ID, err))
+				continue
+			}
+			cr.Pattern.MatchTimeout = cr.Timeout
+		}
+		if rule.Fix != nil {
+			if cr.FixUnless, err = CompileFix(rule, cr.Timeout); err != nil {
+				errs = append(errs, fmt.Errorf("invalid fix for rule %s: %w", rule.ID, err))
+				continue
+			}
+		}
+		set.rules = append(set.rules, cr)
+	}
+
+	return set, errors.Join(errs...)
+}
+
+// ParseTimeout parses the timeout field of a rule, which must be a positive
+// Go duration such as "500ms" or "10s".
+func ParseTimeout(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive, got %s", s)
+	}
+	return d, nil
+}
+
+// CompileWhen compiles a When expression, checking that it only refers to
+// known Facts.
+func CompileWhen(src string) (*expr.Expr, error) {
+	e, err := expr.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range e.Idents() {
+		if !slices.Contains(Facts, name) {
+			return nil, fmt.Errorf("unknown fact %q (want one of %s)", name, strings.Join(Facts, ", "))
+		}
+	}
+	return e, nil
+}
+
+// CompileFix checks the fix of rule and compiles its Unless regex, which may
+// take up to timeout per match. It returns nil when the fix has no Unless.
+func CompileFix(rule Rule, timeout time.Duration) (*regexp2.Regexp, error) {
+	fix := rule.Fix
+	switch {
+	case fix.Instruction == "" && fix.Replace == nil && fix.Append == "":
+		return nil, fmt.Errorf("fix needs an instruction, replace or append")
+	case rule.Absent():
+		return nil, fmt.Errorf("absence rules have no match to fix")
+	case fix.Replace != nil && (rule.Command != nil || rule.Regex == ""):
+		return nil, fmt.Errorf("replace needs a regex rule")
+	case strings.ContainsAny(fix.Instruction, " \t\n"):
+		return nil, fmt.Errorf("invalid instruction %q", fix.Instruction)
+	}
+	if fix.Unless == "" {
+		return nil, nil
+	}
+	re, err := regexp2.Compile(fix.Unless, regexp2.None)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unless: %w", err)
+	}
+	re.MatchTimeout = timeout
+	return re, nil
+}
+
+// Rules returns the compiled rules in order. The slice must not be modified.
+func (s *RuleSet) Rules() []CompiledRule {
+	return s.rules
+}
+
+// Len returns the number of rules in the set.
+func (s *RuleSet) Len() int {
+	return len(s.rules)
+}
+
+// CommandMatcher is a compiled CommandMatch.
+type CommandMatcher struct {
+	names   map[string]bool
+	args    []*regexp2.Regexp
+	without []*regexp2.Regexp
+	// Unless is the compiled CommandMatch.Unless, nil if not set.
+	Unless *CommandMatcher
+}
+
+// CompileCommand compiles cm, anchoring its argument patterns so they match a
+// whole argument. Each pattern match may take up to timeout.
+func CompileCommand(cm *CommandMatch, timeout time.Duration) (*CommandMatcher, error) {
+	if len(cm.Name) == 0 {
+		return nil, fmt.Errorf("command needs a name")
+	}
+	m := &CommandMatcher{names: make(map[string]bool)}
+	for _, name := range cm.Name {
+		m.names[name] = true
+	}
+
+	var err error
+	if m.args, err = compileArgs(cm.Args, timeout); err != nil {
+		return nil, err
+	}
+	if m.without, err = compileArgs(cm.Without, timeout); err != nil {
+		return nil, err
+	}
+	if cm.Unless != nil {
+		if m.Unless, err = CompileCommand(cm.Unless, timeout); err != nil {
+			return nil, fmt.Errorf("unless: %w", err)
+		}
+	}
+	return m, nil
+}
+
+func compileArgs(patterns []string, timeout time.Duration) ([]*regexp2.Regexp, error) {
+	res := make([]*regexp2.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp2.Compile(`^(?:`+p+`)$`, regexp2.None)
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument pattern %q: %w", p, err)
+		}
+		re.MatchTimeout = timeout
+		res[i] = re
+	}
+	return res, nil
+}
+
+// Matches reports whether cmd has one of the names, an argument for every
+// args pattern and no argument matching a without pattern.
+func (m *CommandMatcher) Matches(cmd shell.Command) (bool, error) {
+	if !m.names[cmd.Name] && !m.names[path.Base(cmd.Name)] {
+		return false, nil
+	}
+	for _, re := range m.args {
+		found, err := anyArg(re, cmd.Args)
+		if err != nil || !found {
+			return false, err
+		}
+	}
+	for _, re := range m.without {
+		found, err := anyArg(re, cmd.Args)
+		if err != nil || found {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// MatchesAny reports whether any of cmds matches.
+func (m *CommandMatcher) MatchesAny(cmds []shell.Command) (bool, error) {
+	for _, cmd := range cmds {
+		if ok, err := m.Matches(cmd); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func anyArg(re *regexp2.Regexp, args []string) (bool, error) {
+	for _, arg := range args {
+		ok, err := re.MatchString(arg)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
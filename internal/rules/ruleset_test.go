@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cr0hn/dockerfile-sec/internal/shell"
+)
+
+func TestCompile(t *testing.T) {
+	all, err := LoadInternal("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := Compile(all, 0)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if set.Len() != len(all) {
+		t.Fatalf("expected %d compiled rules, got %d", len(all), set.Len())
+	}
+	for i, cr := range set.Rules() {
+		if cr.ID != all[i].ID {
+			t.Errorf("rule %d = %s, want %s: order must be kept", i, cr.ID, all[i].ID)
+		}
+		if (cr.Pattern == nil) == (cr.Matcher == nil) {
+			t.Errorf("rule %s must have exactly one of Pattern and Matcher", cr.ID)
+		}
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	set, err := Compile([]Rule{
+		{ID: "bad-001", Regex: "[invalid"},
+		{ID: "ok-001", Regex: "(x)"},
+		{ID: "bad-002", Command: &CommandMatch{Name: StringList{"pip"}, Without: StringList{"(open"}}},
+		{ID: "bad-003", Command: &CommandMatch{}},
+	}, 0)
+	if err == nil {
+		t.Fatal("expected error for invalid rules")
+	}
+	for _, want := range []string{"invalid regex for rule bad-001", "invalid command for rule bad-002", "invalid command for rule bad-003"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if set.Len() != 1 || set.Rules()[0].ID != "ok-001" {
+		t.Errorf("expected only ok-001 to compile, got %+v", set.Rules())
+	}
+}
+
+func TestCompileTimeout(t *testing.T) {
+	set, err := Compile([]Rule{
+		{ID: "default-001", Regex: "(x)"},
+		{ID: "own-001", Regex: "(x)", Timeout: "250ms"},
+		{ID: "own-002", Command: &CommandMatch{Name: StringList{"pip"}}, Timeout: "1m"},
+		{ID: "bad-001", Regex: "(x)", Timeout: "soon"},
+	}, 2*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "invalid timeout for rule bad-001") {
+		t.Errorf("expected invalid timeout error for bad-001, got %v", err)
+	}
+
+	want := map[string]time.Duration{"default-001": 2 * time.Second, "own-001": 250 * time.Millisecond, "own-002": time.Minute}
+	if set.Len() != len(want) {
+		t.Fatalf("expected %d compiled rules, got %d", len(want), set.Len())
+	}
+	for _, cr := range set.Rules() {
+		if cr.Timeout != want[cr.ID] {
+			t.Errorf("rule %s timeout = %v, want %v", cr.ID, cr.Timeout, want[cr.ID])
+		}
+		if cr.Pattern != nil && cr.Pattern.MatchTimeout != cr.Timeout {
+			t.Errorf("rule %s regex timeout = %v, want %v", cr.ID, cr.Pattern.MatchTimeout, cr.Timeout)
+		}
+	}
+
+	if set, _ := Compile([]Rule{{ID: "x", Regex: "(x)"}}, 0); set.Rules()[0].Timeout != DefaultTimeout {
+		t.Errorf("expected DefaultTimeout when no timeout is given, got %v", set.Rules()[0].Timeout)
+	}
+}
+
+func TestCompileWhen(t *testing.T) {
+	set, err := Compile([]Rule{
+		{ID: "when-001", When: `instruction == "FROM"`},
+		{ID: "when-002", When: `instruction == "RUN"`, Regex: "(curl)"},
+		{ID: "bad-001", When: `instruction ==`},
+		{ID: "bad-002", When: `tag == "latest"`},
+	}, 0)
+	for _, want := range []string{"invalid when for rule bad-001", `invalid when for rule bad-002: unknown fact "tag"`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not mention %q", err, want)
+		}
+	}
+	if set.Len() != 2 {
+		t.Fatalf("expected 2 compiled rules, got %d", set.Len())
+	}
+	if r := set.Rules()[0]; r.Condition == nil || r.Pattern != nil {
+		t.Errorf("when-only rule must have a condition and no pattern, got %+v", r)
+	}
+	if r := set.Rules()[1]; r.Condition == nil || r.Pattern == nil {
+		t.Errorf("when and regex rule must have both, got %+v", r)
+	}
+}
+
+func TestCompileFix(t *testing.T) {
+	empty := ""
+	tests := []struct {
+		rule Rule
+		want string
+	}{
+		{Rule{ID: "ok-001", Regex: "(.+)", Fix: &Fix{Instruction: "COPY", Unless: "://"}}, ""},
+		{Rule{ID: "ok-002", Regex: "(.+)", Fix: &Fix{Replace: &empty}}, ""},
+		{Rule{ID: "bad-001", Regex: "(.+)", Fix: &Fix{}}, "fix needs an instruction, replace or append"},
+		{Rule{ID: "bad-002", Regex: "(.+)", Match: MatchAbsent, Fix: &Fix{Append: "x"}}, "absence rules"},
+		{Rule{ID: "bad-003", When: "true", Fix: &Fix{Replace: &empty}}, "replace needs a regex rule"},
+		{Rule{ID: "bad-004", Regex: "(.+)", Fix: &Fix{Instruction: "LABEL x"}}, "invalid instruction"},
+		{Rule{ID: "bad-005", Regex: "(.+)", Fix: &Fix{Append: "x", Unless: "("}}, "invalid unless"},
+	}
+	for _, tt := range tests {
+		set, err := Compile([]Rule{tt.rule}, 0)
+		if tt.want == "" {
+			if err != nil || set.Rules()[0].FixUnless == nil && tt.rule.Fix.Unless != "" {
+				t.Errorf("Compile(%s) = %v", tt.rule.ID, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "invalid fix for rule "+tt.rule.ID+": "+tt.want) {
+			t.Errorf("Compile(%s) error = %v, want %q", tt.rule.ID, err, tt.want)
+		}
+	}
+}
+
+func TestCommandMatcher(t *testing.T) {
+	m, err := CompileCommand(&CommandMatch{
+		Name:    StringList{"pip", "pip3"},
+		Args:    StringList{"install"},
+		Without: StringList{"--no-cache-dir"},
+	}, DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		script string
+		want   bool
+	}{
+		{"pip install requests", true},
+		{"/usr/local/bin/pip3 install requests", true},
+		{"pip install --no-cache-dir requests", false},
+		{"pip reinstall requests", false},
+		{"pipx install requests", false},
+	}
+	for _, tt := range tests {
+		got, err := m.Matches(shell.Parse(tt.script)[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.script, got, tt.want)
+		}
+	}
+}
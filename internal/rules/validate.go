@@ -0,0 +1,213 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+	"gopkg.in/yaml.v3"
+)
+
+// Severities accepted in the severity field of a rule.
+var severities = []string{"Low", "Medium", "High", "Critical"}
+
+// ValidationError is a problem with a single rule definition.
+type ValidationError struct {
+	// Source is the file path or URL the rule was loaded from.
+	Source string
+	// Line is the YAML line of the offending field, or of the rule itself.
+	Line int
+	// RuleID is empty when the rule has no id.
+	RuleID string
+	Msg    string
+}
+
+func (e ValidationError) Error() string {
+	rule := "rule"
+	if e.RuleID != "" {
+		rule += " " + e.RuleID
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", e.Source, e.Line, rule, e.Msg)
+}
+
+// ValidationErrors lists every invalid rule found while loading rules. Loaders
+// return it alongside the valid rules, so callers can choose to warn and go on
+// or to fail.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ve := range e {
+		msgs[i] = ve.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// parseYAML decodes a list of rules and validates each of them. Invalid rules
+// are left out of the result and reported as ValidationErrors, naming source
+// and the YAML line of the problem.
+func parseYAML(data []byte, source string) ([]Rule, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing rules YAML %s: %w", source, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	list := doc.Content[0]
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("parsing rules YAML %s: line %d: expected a list of rules", source, list.Line)
+	}
+
+	var (
+		rules []Rule
+		errs  ValidationErrors
+		seen  = make(map[string]int)
+	)
+	for _, node := range list.Content {
+		var rule Rule
+		if err := node.Decode(&rule); err != nil {
+			errs = append(errs, ValidationError{Source: source, Line: node.Line, Msg: err.Error()})
+			continue
+		}
+
+		problems := validateRule(rule, node)
+		if line, dup := seen[rule.ID]; dup && rule.ID != "" {
+			problems = append(problems, ValidationError{Line: fieldLine(node, "id"), Msg: fmt.Sprintf("duplicate id, first defined on line %d", line)})
+		}
+		if len(problems) > 0 {
+			for _, p := range problems {
+				p.Source, p.RuleID = source, rule.ID
+				errs = append(errs, p)
+			}
+			continue
+		}
+
+		rule.source, rule.line = source, fieldLine(node, "id")
+		seen[rule.ID] = rule.line
+		rules = append(rules, rule)
+	}
+
+	if len(errs) > 0 {
+		return rules, errs
+	}
+	return rules, nil
+}
+
+// UniqueIDs returns the rules of list whose ID is not used by any of taken or
+// by an earlier rule of list. The others are left out and reported as
+// ValidationErrors naming where the ID was first defined, since -i and
+// suppression comments must target a single rule. Taken rules without a
+// source are Go checks.
+func UniqueIDs(taken, list []Rule) ([]Rule, error) {
+	first := make(map[string]Rule, len(taken)+len(list))
+	for _, rule := range taken {
+		if _, dup := first[rule.ID]; !dup {
+			first[rule.ID] = rule
+		}
+	}
+
+	var (
+		unique []Rule
+		errs   ValidationErrors
+	)
+	for _, rule := range list {
+		prev, dup := first[rule.ID]
+		if !dup {
+			first[rule.ID] = rule
+			unique = append(unique, rule)
+			continue
+		}
+		msg := fmt.Sprintf("duplicate id, first defined in %s:%d", prev.source, prev.line)
+		if prev.source == "" {
+			msg = "duplicate id, used by a built-in check"
+		}
+		errs = append(errs, ValidationError{Source: rule.source, Line: rule.line, RuleID: rule.ID, Msg: msg})
+	}
+
+	if len(errs) > 0 {
+		return unique, errs
+	}
+	return unique, nil
+}
+
+// validateRule checks a decoded rule, using node for line numbers.
+func validateRule(rule Rule, node *yaml.Node) []ValidationError {
+	var problems []ValidationError
+	add := func(field, format string, args ...any) {
+		problems = append(problems, ValidationError{Line: fieldLine(node, field), Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(rule.ID) == "" {
+		add("id", "missing id")
+	}
+
+	switch {
+	case rule.Command != nil && rule.Regex != "":
+		add("regex", "regex and command are mutually exclusive")
+	case rule.Command != nil:
+		if _, err := CompileCommand(rule.Command, DefaultTimeout); err != nil {
+			add("command", "invalid command: %v", err)
+		}
+	case strings.TrimSpace(rule.Regex) == "" && rule.When != "":
+		// A when-only rule reports the instructions its condition holds for.
+	case strings.TrimSpace(rule.Regex) == "":
+		add("regex", "empty regex")
+	default:
+		if _, err := regexp2.Compile(rule.Regex, regexp2.Multiline); err != nil {
+			add("regex", "invalid regex: %v", err)
+		}
+	}
+
+	if !validSeverity(rule.Severity) {
+		add("severity", "unknown severity %q (want %s)", rule.Severity, strings.Join(severities, ", "))
+	}
+	if rule.Match != "" && !strings.EqualFold(rule.Match, MatchPresent) && !rule.Absent() {
+		add("match", "unknown match %q (want %s or %s)", rule.Match, MatchPresent, MatchAbsent)
+	}
+	if rule.Stages != "" && !strings.EqualFold(rule.Stages, StagesAll) && !rule.FinalOnly() {
+		add("stages", "unknown stages %q (want %s or %s)", rule.Stages, StagesAll, StagesFinal)
+	}
+	if rule.When != "" {
+		if _, err := CompileWhen(rule.When); err != nil {
+			add("when", "invalid when: %v", err)
+		}
+	}
+	if rule.Fix != nil {
+		if _, err := CompileFix(rule, DefaultTimeout); err != nil {
+			add("fix", "invalid fix: %v", err)
+		}
+	}
+	if rule.ExampleFix != nil && (strings.TrimSpace(rule.ExampleFix.Before) == "" || strings.TrimSpace(rule.ExampleFix.After) == "") {
+		add("example_fix", "example_fix needs a before and an after snippet")
+	}
+	if rule.Timeout != "" {
+		if _, err := ParseTimeout(rule.Timeout); err != nil {
+			add("timeout", "invalid timeout %q: %v", rule.Timeout, err)
+		}
+	}
+
+	return problems
+}
+
+func validSeverity(severity string) bool {
+	for _, s := range severities {
+		if strings.EqualFold(severity, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldLine returns the line of the value of key in mapping node, or the line
+// of the node itself when the key is missing.
+func fieldLine(node *yaml.Node, key string) int {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1].Line
+			}
+		}
+	}
+	return node.Line
+}
@@ -0,0 +1,443 @@
+// Package shell splits the shell form of RUN instructions into individual
+// commands so rules can inspect command names and arguments instead of
+// matching the raw text.
+package shell
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Command is a simple command: a name followed by its arguments, delimited by
+// operators such as &&, ||, ;, | and &, or by subshell parentheses.
+type Command struct {
+	// Name is the unquoted command name. Leading VAR=value assignments and
+	// keywords such as "if" or "do" are skipped.
+	Name string
+	// Args are the unquoted arguments. Redirections are not included.
+	Args []string
+	// Start and End are the rune offsets of the command within the script;
+	// End is exclusive.
+	Start int
+	End   int
+	// Text is the command as written, from its name to its last argument.
+	Text string
+}
+
+// HasArg reports whether arg is one of the command's arguments.
+func (c Command) HasArg(arg string) bool {
+	for _, a := range c.Args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	// operatorToken ends a command: &&, ||, ;, |, &, (, ) or a newline.
+	operatorToken
+	// redirectToken is a redirection operator such as ">", "2>" or "2>&1".
+	redirectToken
+)
+
+type token struct {
+	kind tokenKind
+	// text is the unquoted word or the operator.
+	text       string
+	start, end int
+	// target is false for redirections that carry their target, like "2>&1".
+	target bool
+	// heredoc is set for "<<" redirections whose body was found; body holds
+	// the rune offsets of the body within the script.
+	heredoc bool
+	body    [2]int
+}
+
+// shells are the commands that run a heredoc body as a script.
+var shells = map[string]bool{"sh": true, "bash": true, "ash": true, "dash": true, "zsh": true}
+
+var (
+	assignmentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	// keywords may precede the name of a command.
+	keywords = map[string]bool{
+		"if": true, "then": true, "else": true, "elif": true, "fi": true,
+		"while": true, "until": true, "do": true, "done": true,
+		"{": true, "}": true, "!": true, "time": true, "esac": true,
+	}
+)
+
+// Parse splits script into its simple commands in order of appearance.
+// Commands in subshells and in $(...) or backtick substitutions are included
+// as commands of their own, as are the commands of heredoc bodies fed to a
+// shell (or standing alone, as in "RUN <<EOF"). An exec-form JSON array such
+// as ["apt-get", "install", "curl"] is returned as a single command.
+func Parse(script string) []Command {
+	if cmd, ok := parseExec(script); ok {
+		return []Command{cmd}
+	}
+
+	runes := []rune(script)
+	l := &lexer{runes: runes}
+	l.run()
+
+	commands := l.nested
+	var words []token
+	flush := func() {
+		if cmd, ok := newCommand(runes, words); ok {
+			commands = append(commands, cmd)
+		}
+		words = words[:0]
+	}
+
+	for i := 0; i < len(l.tokens); i++ {
+		tok := l.tokens[i]
+		switch tok.kind {
+		case operatorToken:
+			flush()
+		case redirectToken:
+			if tok.heredoc && runsScript(words) {
+				for _, cmd := range Parse(string(runes[tok.body[0]:tok.body[1]])) {
+					cmd.Start += tok.body[0]
+					cmd.End += tok.body[0]
+					commands = append(commands, cmd)
+				}
+			}
+			if tok.target && i+1 < len(l.tokens) && l.tokens[i+1].kind == wordToken {
+				i++
+			}
+		default:
+			words = append(words, tok)
+		}
+	}
+	flush()
+
+	sort.SliceStable(commands, func(i, j int) bool { return commands[i].Start < commands[j].Start })
+	return commands
+}
+
+// runsScript reports whether a heredoc given to the command being built from
+// words is a script: the command is a shell, or there is no command at all.
+func runsScript(words []token) bool {
+	for _, w := range words {
+		if !assignmentRe.MatchString(w.text) && !keywords[w.text] {
+			return shells[w.text]
+		}
+	}
+	return true
+}
+
+// newCommand builds a command from its words, skipping assignments and keywords.
+func newCommand(runes []rune, words []token) (Command, bool) {
+	first := 0
+	for first < len(words) && (assignmentRe.MatchString(words[first].text) || keywords[words[first].text]) {
+		first++
+	}
+	if first == len(words) {
+		return Command{}, false
+	}
+
+	cmd := Command{
+		Name:  words[first].text,
+		Start: words[first].start,
+		End:   words[len(words)-1].end,
+	}
+	for _, w := range words[first+1:] {
+		cmd.Args = append(cmd.Args, w.text)
+	}
+	cmd.Text = string(runes[cmd.Start:cmd.End])
+	return cmd, true
+}
+
+// IsExec reports whether script is in the exec (JSON array) form of RUN, CMD
+// and ENTRYPOINT, e.g. ["pip", "install", "flask"].
+func IsExec(script string) bool {
+	_, ok := parseExec(script)
+	return ok
+}
+
+// parseExec parses the exec (JSON array) form of RUN, CMD and ENTRYPOINT.
+func parseExec(script string) (Command, bool) {
+	trimmed := strings.TrimSpace(script)
+	if !strings.HasPrefix(trimmed, "[") {
+		return Command{}, false
+	}
+	var argv []string
+	if err := json.Unmarshal([]byte(trimmed), &argv); err != nil || len(argv) == 0 {
+		return Command{}, false
+	}
+	start := len([]rune(script)) - len([]rune(strings.TrimLeft(script, " \t")))
+	return Command{
+		Name:  argv[0],
+		Args:  argv[1:],
+		Start: start,
+		End:   start + len([]rune(trimmed)),
+		Text:  trimmed,
+	}, true
+}
+
+// lexer splits a script into words, operators and redirections.
+type lexer struct {
+	runes  []rune
+	pos    int
+	tokens []token
+	// nested holds the commands found in substitutions.
+	nested []Command
+	// pending holds the heredocs whose body starts on the next line.
+	pending []pendingHeredoc
+}
+
+type pendingHeredoc struct {
+	// token is the index of the "<<" redirection.
+	token     int
+	delimiter string
+	strip     bool
+}
+
+func (l *lexer) run() {
+	for l.pos < len(l.runes) {
+		r := l.runes[l.pos]
+		switch {
+		case r == ' ' || r == '\t' || r == '\r':
+			l.pos++
+		case r == '\n':
+			l.emit(operatorToken, "\n", l.pos, l.pos+1)
+			l.pos++
+			l.heredocBodies()
+		case r == '#':
+			for l.pos < len(l.runes) && l.runes[l.pos] != '\n' {
+				l.pos++
+			}
+		case r == '&' && l.peek(1) == '>':
+			l.redirect(l.pos)
+		case r == '&' || r == '|' || r == ';':
+			start := l.pos
+			l.pos++
+			if next := l.peek(0); next == r || (r == '|' && next == '&') {
+				l.pos++
+			}
+			l.emit(operatorToken, string(l.runes[start:l.pos]), start, l.pos)
+		case r == '(' || r == ')':
+			l.emit(operatorToken, string(r), l.pos, l.pos+1)
+			l.pos++
+		case r == '<' || r == '>':
+			l.redirect(l.pos)
+		default:
+			l.word()
+		}
+	}
+}
+
+func (l *lexer) peek(n int) rune {
+	if l.pos+n < len(l.runes) {
+		return l.runes[l.pos+n]
+	}
+	return 0
+}
+
+func (l *lexer) emit(kind tokenKind, text string, start, end int) {
+	l.tokens = append(l.tokens, token{kind: kind, text: text, start: start, end: end})
+}
+
+// redirect lexes a redirection operator starting at start, which may include
+// a file descriptor prefix already consumed by word.
+func (l *lexer) redirect(start int) {
+	for l.pos < len(l.runes) && strings.ContainsRune("<>&|", l.runes[l.pos]) {
+		l.pos++
+	}
+	if string(l.runes[start:l.pos]) == "<<" {
+		l.heredocMarker(start)
+		return
+	}
+	target := true
+	if l.runes[l.pos-1] == '&' {
+		// Descriptor duplication such as 2>&1 or >&-.
+		for l.pos < len(l.runes) && (isDigit(l.runes[l.pos]) || l.runes[l.pos] == '-') {
+			l.pos++
+			target = false
+		}
+	}
+	l.tokens = append(l.tokens, token{
+		kind:   redirectToken,
+		text:   string(l.runes[start:l.pos]),
+		start:  start,
+		end:    l.pos,
+		target: target,
+	})
+}
+
+// heredocMarker lexes the delimiter of a "<<" or "<<-" redirection starting
+// at start, whose operator has been consumed.
+func (l *lexer) heredocMarker(start int) {
+	strip := l.peek(0) == '-'
+	if strip {
+		l.pos++
+	}
+	for l.pos < len(l.runes) && (l.runes[l.pos] == ' ' || l.runes[l.pos] == '\t') {
+		l.pos++
+	}
+	tok := token{kind: redirectToken, start: start}
+	if l.pos < len(l.runes) && !strings.ContainsRune("\n;&|()<>", l.runes[l.pos]) {
+		l.word()
+		delim := l.tokens[len(l.tokens)-1]
+		l.tokens = l.tokens[:len(l.tokens)-1]
+		l.pending = append(l.pending, pendingHeredoc{token: len(l.tokens), delimiter: delim.text, strip: strip})
+	}
+	tok.text = string(l.runes[start:l.pos])
+	tok.end = l.pos
+	l.tokens = append(l.tokens, tok)
+}
+
+// heredocBodies consumes the bodies of pending heredocs, which start at the
+// current position, recording their spans on the "<<" tokens.
+func (l *lexer) heredocBodies() {
+	for _, h := range l.pending {
+		start := l.pos
+		for l.pos < len(l.runes) {
+			end := l.find('\n', l.pos)
+			line := string(l.runes[l.pos:end])
+			if h.strip {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == h.delimiter {
+				l.tokens[h.token].heredoc = true
+				l.tokens[h.token].body = [2]int{start, l.pos}
+				l.pos = min(end+1, len(l.runes))
+				break
+			}
+			l.pos = min(end+1, len(l.runes))
+		}
+	}
+	l.pending = nil
+}
+
+// word lexes a word, removing quotes and escapes from its text.
+func (l *lexer) word() {
+	start := l.pos
+	var b strings.Builder
+	for l.pos < len(l.runes) {
+		r := l.runes[l.pos]
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n' || strings.ContainsRune(";&|()", r):
+			l.emit(wordToken, b.String(), start, l.pos)
+			return
+		case r == '<' || r == '>':
+			if l.pos > start && isDigits(l.runes[start:l.pos]) {
+				l.redirect(start)
+				return
+			}
+			l.emit(wordToken, b.String(), start, l.pos)
+			return
+		case r == '\\':
+			l.pos++
+			if l.pos < len(l.runes) {
+				b.WriteRune(l.runes[l.pos])
+				l.pos++
+			}
+		case r == '\'':
+			end := l.find('\'', l.pos+1)
+			b.WriteString(string(l.runes[l.pos+1 : end]))
+			l.pos = min(end+1, len(l.runes))
+		case r == '"':
+			l.pos++
+			for l.pos < len(l.runes) && l.runes[l.pos] != '"' {
+				switch {
+				case l.runes[l.pos] == '\\' && strings.ContainsRune("\"\\$`", l.peek(1)):
+					b.WriteRune(l.peek(1))
+					l.pos += 2
+				case l.runes[l.pos] == '$' && l.peek(1) == '(':
+					b.WriteString(l.substitution())
+				default:
+					b.WriteRune(l.runes[l.pos])
+					l.pos++
+				}
+			}
+			l.pos = min(l.pos+1, len(l.runes))
+		case r == '$' && l.peek(1) == '(':
+			b.WriteString(l.substitution())
+		case r == '$' && l.peek(1) == '{':
+			end := l.find('}', l.pos)
+			b.WriteString(string(l.runes[l.pos:min(end+1, len(l.runes))]))
+			l.pos = min(end+1, len(l.runes))
+		case r == '`':
+			end := l.find('`', l.pos+1)
+			l.parseNested(l.pos+1, end)
+			b.WriteString(string(l.runes[l.pos:min(end+1, len(l.runes))]))
+			l.pos = min(end+1, len(l.runes))
+		default:
+			b.WriteRune(r)
+			l.pos++
+		}
+	}
+	l.emit(wordToken, b.String(), start, l.pos)
+}
+
+// substitution consumes a $(...) substitution, parsing the commands inside,
+// and returns it as written.
+func (l *lexer) substitution() string {
+	start := l.pos
+	depth := 0
+	var quote rune
+	for l.pos < len(l.runes) {
+		r := l.runes[l.pos]
+		l.pos++
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				l.parseNested(start+2, l.pos-1)
+				return string(l.runes[start:l.pos])
+			}
+		}
+	}
+	l.parseNested(start+2, l.pos)
+	return string(l.runes[start:l.pos])
+}
+
+// parseNested parses runes[start:end] as a script of its own.
+func (l *lexer) parseNested(start, end int) {
+	if start >= end {
+		return
+	}
+	for _, cmd := range Parse(string(l.runes[start:end])) {
+		cmd.Start += start
+		cmd.End += start
+		l.nested = append(l.nested, cmd)
+	}
+}
+
+// find returns the index of the next r from pos, or the end of the script.
+func (l *lexer) find(r rune, pos int) int {
+	for ; pos < len(l.runes); pos++ {
+		if l.runes[pos] == r {
+			return pos
+		}
+	}
+	return len(l.runes)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isDigits(rs []rune) bool {
+	for _, r := range rs {
+		if !isDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func names(cmds []Command) []string {
+	var out []string
+	for _, c := range cmds {
+		out = append(out, c.Name)
+	}
+	return out
+}
+
+func TestParseOperators(t *testing.T) {
+	cmds := Parse("apt-get update && apt-get install -y curl; rm -rf /var/lib/apt/lists/* || true | cat & wait")
+
+	want := []string{"apt-get", "apt-get", "rm", "true", "cat", "wait"}
+	if got := names(cmds); !reflect.DeepEqual(got, want) {
+		t.Fatalf("names = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(cmds[1].Args, []string{"install", "-y", "curl"}) {
+		t.Errorf("args = %q", cmds[1].Args)
+	}
+	if cmds[1].Text != "apt-get install -y curl" || cmds[1].Start != 18 || cmds[1].End != 41 {
+		t.Errorf("command span = %q at %d-%d", cmds[1].Text, cmds[1].Start, cmds[1].End)
+	}
+}
+
+func TestParseQuoting(t *testing.T) {
+	cmds := Parse(`echo "a && b" 'c; d' e\ f "x\"y"`)
+	if len(cmds) != 1 {
+		t.Fatalf("expected 1 command, got %v", names(cmds))
+	}
+	want := []string{"a && b", "c; d", "e f", `x"y`}
+	if !reflect.DeepEqual(cmds[0].Args, want) {
+		t.Errorf("args = %q, want %q", cmds[0].Args, want)
+	}
+}
+
+func TestParseSubshells(t *testing.T) {
+	cmds := Parse("(cd /src && make) && echo $(git rev-parse HEAD) `date`")
+
+	want := []string{"cd", "make", "echo", "git", "date"}
+	if got := names(cmds); !reflect.DeepEqual(got, want) {
+		t.Fatalf("names = %v, want %v", got, want)
+	}
+	if git := cmds[3]; git.Text != "git rev-parse HEAD" || git.Start != 28 {
+		t.Errorf("substitution command = %q at %d", git.Text, git.Start)
+	}
+	if cmds[2].Args[0] != "$(git rev-parse HEAD)" {
+		t.Errorf("substitution word = %q", cmds[2].Args[0])
+	}
+}
+
+func TestParseAssignmentsAndRedirections(t *testing.T) {
+	cmds := Parse("DEBIAN_FRONTEND=noninteractive apt-get install -y curl >/dev/null 2>&1 && if true; then pip install x 2> err.log; fi")
+
+	want := []string{"apt-get", "true", "pip"}
+	if got := names(cmds); !reflect.DeepEqual(got, want) {
+		t.Fatalf("names = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(cmds[0].Args, []string{"install", "-y", "curl"}) {
+		t.Errorf("apt-get args = %q", cmds[0].Args)
+	}
+	if !reflect.DeepEqual(cmds[2].Args, []string{"install", "x"}) {
+		t.Errorf("pip args = %q", cmds[2].Args)
+	}
+	if !cmds[2].HasArg("install") || cmds[2].HasArg("err.log") {
+		t.Error("HasArg mismatch")
+	}
+}
+
+func TestParseExecForm(t *testing.T) {
+	cmds := Parse(` ["apt-get", "install", "-y", "curl"]`)
+	if len(cmds) != 1 || cmds[0].Name != "apt-get" || len(cmds[0].Args) != 3 || cmds[0].Start != 1 {
+		t.Errorf("exec form = %+v", cmds)
+	}
+	if !IsExec(` ["pip", "install", "flask"]`) || IsExec(`pip install "[extra]"`) || IsExec(`[ -f x ] && echo`) {
+		t.Error("IsExec must only accept JSON arrays")
+	}
+}
+
+func TestParseUnterminated(t *testing.T) {
+	// Malformed scripts must not panic.
+	for _, s := range []string{`echo "open`, `echo 'open`, "echo $(open", "echo `open", "echo ${open", "cmd 2>", ""} {
+		Parse(s)
+	}
+}
+
+func TestParseHeredocs(t *testing.T) {
+	script := "<<EOF\napt-get update\napt-get install -y curl\nEOF"
+	cmds := Parse(script)
+	if got := names(cmds); !reflect.DeepEqual(got, []string{"apt-get", "apt-get"}) {
+		t.Fatalf("names = %v", got)
+	}
+	if cmds[1].Text != "apt-get install -y curl" || cmds[1].Start != 21 {
+		t.Errorf("heredoc command = %q at %d", cmds[1].Text, cmds[1].Start)
+	}
+
+	// Bodies fed to other commands are data, not commands.
+	cmds = Parse("cat <<-'CONF' > /etc/app.conf && bash <<SH\n\trm -rf /\n\tCONF\nmake install\nSH\necho done")
+	if got := names(cmds); !reflect.DeepEqual(got, []string{"cat", "bash", "make", "echo"}) {
+		t.Fatalf("names = %v", got)
+	}
+	if len(cmds[0].Args) != 0 {
+		t.Errorf("cat args = %q, want none", cmds[0].Args)
+	}
+
+	// Here-strings have no body.
+	if got := names(Parse("grep x <<< \"$v\"\nls")); !reflect.DeepEqual(got, []string{"grep", "ls"}) {
+		t.Errorf("names = %v", got)
+	}
+}